@@ -23,15 +23,21 @@ const (
 type Argocd struct {
 	// +private
 	Version string
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // Argo CD constructor
 func New(
 	// Argo CD version to get
 	version string,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with Argo CD
+	// +optional
+	caCertificates []*dagger.File,
 ) *Argocd {
 	argocd := &Argocd{
-		Version: version,
+		Version:        version,
+		CaCertificates: caCertificates,
 	}
 
 	return argocd
@@ -163,7 +169,9 @@ func (argocd *Argocd) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: argocd.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform})
 
 	return argocd.Container(ctx, container)
 }
@@ -175,7 +183,9 @@ func (argocd *Argocd) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: argocd.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
 
 	return argocd.Container(ctx, container)
 }
@@ -187,7 +197,9 @@ func (argocd *Argocd) RedhatMicroContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: argocd.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
 
 	return argocd.Container(ctx, container)
 }
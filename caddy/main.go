@@ -82,3 +82,23 @@ func (caddy *Caddy) Container(
 func (caddy *Caddy) Server() *dagger.Service {
 	return caddy.Container("", true).AsService(dagger.ContainerAsServiceOpts{UseEntrypoint: true})
 }
+
+// Get a changeset updating the pinned Caddy container image to its latest tag
+// +cache="never"
+func (*Caddy) Update(
+	// Registry to query instead of the registry of the pinned image (can be used to query a mirror or a local registry)
+	// +optional
+	registry string,
+	// Service providing the registry to query
+	// +optional
+	registryService *dagger.Service,
+	// Query the registry without verifying TLS certificates or over plain HTTP
+	// +optional
+	insecure bool,
+) *dagger.Changeset {
+	return dag.Redhat().ImageUpdates(dag.CurrentModule().Source(), dagger.RedhatImageUpdatesOpts{
+		Registry:        registry,
+		RegistryService: registryService,
+		Insecure:        insecure,
+	})
+}
@@ -33,6 +33,15 @@ func (*Documentation) Builder(
 	ctx context.Context,
 	// Directory containing documentation to build
 	directory *dagger.Directory,
+	// Glob patterns of private Go module paths used as Hugo modules (GOPRIVATE)
+	// +optional
+	goPrivate string,
+	// netrc file with credentials to access private Hugo modules
+	// +optional
+	netrc *dagger.Secret,
+	// Git credentials file with credentials to access private Hugo modules (as stored by Git store credential helper)
+	// +optional
+	gitCredentials *dagger.Secret,
 ) (*DocumentationBuilder, error) {
 	const packageJsonFilename string = "package.json"
 
@@ -58,18 +67,33 @@ func (*Documentation) Builder(
 		return nil, fmt.Errorf("Hugo version is not set in %q file", packageJsonFilename)
 	}
 
+	nodejs := dag.Nodejs().WithProjectVersion(directory)
+
 	builder := &DocumentationBuilder{}
 
 	kroki := dag.Kroki()
 
-	builder.Container = dag.Redhat().Minimal().Container().
-		With(dag.Nodejs().RedhatMinimalInstallation).
-		With(dag.Golang().RedhatMinimalInstallation).
-		With(dag.Hugo(configuration.Hugo.Version, dagger.HugoOpts{Extended: true}).Installation).
-		WithServiceBinding("kroki", kroki.Server()).
-		WithMountedDirectory(".", directory).
-		WithExec([]string{"npm", "clean-install"}).
-		WithEntrypoint([]string{"npm", "run", "build", "--"}).
+	project := nodejs.Project(dagger.NodejsProjectOpts{
+		Source: directory,
+		Container: dag.Redhat().Minimal().Container().
+			With(nodejs.RedhatMinimalInstallation).
+			With(dag.Golang(dagger.GolangOpts{
+				Private:        goPrivate,
+				Netrc:          netrc,
+				GitCredentials: gitCredentials,
+			}).RedhatMinimalInstallation).
+			With(dag.Hugo(configuration.Hugo.Version, dagger.HugoOpts{Extended: true}).Installation).
+			WithServiceBinding("kroki", kroki.Server()),
+	})
+
+	packageManager, err := project.PackageManager(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %w", err)
+	}
+
+	builder.Container = project.Container().
+		WithEntrypoint([]string{packageManager, "run", "build", "--"}).
 		WithoutDefaultArgs()
 
 	return builder, nil
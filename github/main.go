@@ -23,15 +23,21 @@ const (
 type Github struct {
 	// +private
 	Version string
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // GitHub constructor
 func New(
 	// GitHub version to get
 	version string,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with GitHub
+	// +optional
+	caCertificates []*dagger.File,
 ) *Github {
 	github := &Github{
-		Version: version,
+		Version:        version,
+		CaCertificates: caCertificates,
 	}
 
 	return github
@@ -182,8 +188,10 @@ func (github *Github) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform}).
-		With(dag.Redhat().Packages([]string{
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: github.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform}).
+		With(redhat.Packages([]string{
 			"git",
 		}).Installed)
 
@@ -197,8 +205,10 @@ func (github *Github) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
-		With(dag.Redhat().Minimal().Packages([]string{
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: github.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
+		With(redhat.Minimal().Packages([]string{
 			"git",
 		}).Installed)
 
@@ -214,7 +224,9 @@ func (github *Github) RedhatMicroContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: github.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
 
 	return github.Container(ctx, container)
 }
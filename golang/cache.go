@@ -0,0 +1,69 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/golang/internal/dagger"
+	"fmt"
+)
+
+// Get Go caches of a platform as a directory
+//
+// Directory contains module download cache and build cache, it can be given to the constructor to warm start cache volumes of ephemeral runners.
+func (golang *Golang) CacheExport(
+	ctx context.Context,
+	// Platform to get build cache of
+	// +optional
+	platform dagger.Platform,
+) (*dagger.Directory, error) {
+	container, err := golang.RedhatContainer(ctx, platform)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Go container: %s", err)
+	}
+
+	cache := container.
+		WithExec([]string{"mkdir", "-p", "/tmp/cache"}).
+		WithExec([]string{"cp", "--archive", CacheDir + "/" + ModCacheName, CacheDir + "/" + BuildCacheName, "/tmp/cache/"}).
+		Directory("/tmp/cache")
+
+	return cache, nil
+}
+
+// Remove content of Go caches of a platform
+// +cache="never"
+func (golang *Golang) CachePrune(
+	ctx context.Context,
+	// Platform to remove build cache of
+	// +optional
+	platform dagger.Platform,
+	// Also remove shared module download cache
+	// +optional
+	modules bool,
+) error {
+	container, err := golang.RedhatContainer(ctx, platform)
+
+	if err != nil {
+		return fmt.Errorf("failed to get Go container: %s", err)
+	}
+
+	// Cache volumes mount points cannot be removed, only their content
+	directories := CacheDir + "/" + BuildCacheName
+
+	if modules {
+		// Module download cache is read-only
+		directories += " " + CacheDir + "/" + ModCacheName
+	}
+
+	_, err = container.
+		WithExec([]string{"sh", "-c", "chmod -R u+w " + directories + " && find " + directories + " -mindepth 1 -maxdepth 1 -exec rm -rf {} +"}).
+		Sync(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to remove caches content: %s", err)
+	}
+
+	return nil
+}
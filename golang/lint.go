@@ -0,0 +1,379 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/golang/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// Name of golangci-lint executable binary
+	GolangciLintBinaryName string = "golangci-lint"
+
+	// golangci-lint version to get
+	GolangciLintVersion string = "2.5.0"
+
+	// Name of govulncheck executable binary
+	GovulncheckBinaryName string = "govulncheck"
+
+	// govulncheck version to get
+	GovulncheckVersion string = "1.1.4"
+)
+
+// Get golangci-lint executable binary
+func (golang *Golang) GolangciLintBinary(
+	ctx context.Context,
+	// Platform to get golangci-lint for
+	// +optional
+	platform dagger.Platform,
+) (*dagger.File, error) {
+	if platform == "" {
+		defaultPlatform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platform = defaultPlatform
+	}
+
+	platformElements := strings.Split(string(platform), "/")
+
+	os := platformElements[0]
+	arch := platformElements[1]
+
+	if arch == "arm" {
+		arch = "armv6"
+	}
+
+	downloadURL := "https://github.com/golangci/golangci-lint/releases/download/v" + GolangciLintVersion
+
+	archiveBaseName := fmt.Sprintf("golangci-lint-%s-%s-%s", GolangciLintVersion, os, arch)
+	archiveName := archiveBaseName + ".tar.gz"
+	checksumsName := fmt.Sprintf("golangci-lint-%s-checksums.txt", GolangciLintVersion)
+
+	archive := dag.HTTP(downloadURL + "/" + archiveName)
+	checksums := dag.HTTP(downloadURL + "/" + checksumsName)
+
+	container := golang.redhat().Container().
+		WithMountedFile(archiveName, archive).
+		WithMountedFile(checksumsName, checksums).
+		WithExec([]string{"sh", "-c", "grep -w " + archiveName + " " + checksumsName + " | sha256sum -c"}).
+		WithExec([]string{"tar", "--extract", "--file", archiveName})
+
+	binary := container.File(archiveBaseName + "/" + GolangciLintBinaryName)
+
+	return binary, nil
+}
+
+// Get govulncheck executable binary
+//
+// govulncheck is built from source, modules are verified against the Go checksum database.
+func (golang *Golang) GovulncheckBinary(
+	ctx context.Context,
+	// Platform to get govulncheck for
+	// +optional
+	platform dagger.Platform,
+) (*dagger.File, error) {
+	if platform == "" {
+		defaultPlatform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platform = defaultPlatform
+	}
+
+	platformElements := strings.Split(string(platform), "/")
+
+	container, err := golang.RedhatContainer(ctx, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Go container: %s", err)
+	}
+
+	// Binaries are installed out of the cache to be able to get them
+	container = container.
+		WithEnvVariable("GOPATH", "/tmp/gopath").
+		WithEnvVariable("GOOS", platformElements[0]).
+		WithEnvVariable("GOARCH", platformElements[1]).
+		WithEnvVariable("CGO_ENABLED", "0").
+		WithExec([]string{"go", "install", "golang.org/x/vuln/cmd/govulncheck@v" + GovulncheckVersion}).
+		WithExec([]string{"sh", "-c", "cp $(find /tmp/gopath/bin -name " + GovulncheckBinaryName + " -type f) /tmp/" + GovulncheckBinaryName})
+
+	binary := container.File("/tmp/" + GovulncheckBinaryName)
+
+	return binary, nil
+}
+
+// Get a root filesystem overlay with golangci-lint and govulncheck
+func (golang *Golang) LintOverlay(
+	ctx context.Context,
+	// Platform to get golangci-lint and govulncheck for
+	// +optional
+	platform dagger.Platform,
+	// Filesystem prefix under which to install golangci-lint and govulncheck
+	// +optional
+	prefix string,
+) (*dagger.Directory, error) {
+	if prefix == "" {
+		prefix = "/usr/local"
+	}
+
+	golangciLint, err := golang.GolangciLintBinary(ctx, platform)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get golangci-lint binary: %s", err)
+	}
+
+	govulncheck, err := golang.GovulncheckBinary(ctx, platform)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get govulncheck binary: %s", err)
+	}
+
+	overlay := dag.Directory().
+		WithDirectory(prefix, dag.Directory().
+			WithDirectory("bin", dag.Directory().
+				WithFile(GolangciLintBinaryName, golangciLint).
+				WithFile(GovulncheckBinaryName, govulncheck),
+			),
+		)
+
+	return overlay, nil
+}
+
+// Install golangci-lint and govulncheck in a container
+func (golang *Golang) LintInstallation(
+	ctx context.Context,
+	// Container in which to install golangci-lint and govulncheck
+	container *dagger.Container,
+) (*dagger.Container, error) {
+	platform, err := container.Platform(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container platform: %s", err)
+	}
+
+	overlay, err := golang.LintOverlay(ctx, platform, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lint overlay: %s", err)
+	}
+
+	container = container.
+		WithDirectory("/", overlay).
+		WithMountedCache(CacheDir+"/golangci-lint", dag.CacheVolume("golangci-lint")).
+		WithEnvVariable("GOLANGCI_LINT_CACHE", CacheDir+"/golangci-lint")
+
+	return container, nil
+}
+
+// Go lint finding
+type GolangLintFinding struct {
+	// Get the tool reporting the finding (golangci-lint or govulncheck)
+	Tool string
+	// Get the source file of the finding
+	File string
+	// Get the source line of the finding
+	Line int
+	// Get the rule of the finding (linter name or vulnerability ID)
+	Rule string
+	// Get the message of the finding
+	Message string
+}
+
+// golangci-lint JSON report
+type golangciLintReport struct {
+	Issues []struct {
+		FromLinter string
+		Text       string
+		Pos        struct {
+			Filename string
+			Line     int
+		}
+	}
+}
+
+// govulncheck JSON message
+type govulncheckMessage struct {
+	Osv *struct {
+		ID      string `json:"id"`
+		Summary string `json:"summary"`
+	} `json:"osv"`
+	Finding *struct {
+		Osv          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Function string `json:"function"`
+			Position *struct {
+				Filename string `json:"filename"`
+				Line     int    `json:"line"`
+			} `json:"position"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// Get lint findings of the project with golangci-lint, and vulnerable dependencies called by the project with govulncheck
+func (project *GolangProject) LintFindings(
+	ctx context.Context,
+) ([]*GolangLintFinding, error) {
+	container, err := project.Golang.LintInstallation(ctx, project.Container)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install lint tools: %s", err)
+	}
+
+	findings := []*GolangLintFinding{}
+
+	// golangci-lint exits with 1 when issues are found
+	golangciLint := container.
+		WithExec([]string{GolangciLintBinaryName, "run", "--output.json.path", "stdout", "--show-stats=false", "./..."}, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := golangciLint.ExitCode(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to run golangci-lint: %s", err)
+	}
+
+	if exitCode > 1 {
+		output, _ := golangciLint.Stderr(ctx)
+
+		return nil, fmt.Errorf("failed to run golangci-lint: %s", output)
+	}
+
+	output, err := golangciLint.Stdout(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get golangci-lint output: %s", err)
+	}
+
+	report := golangciLintReport{}
+
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse golangci-lint output: %s", err)
+	}
+
+	for _, issue := range report.Issues {
+		findings = append(findings, &GolangLintFinding{
+			Tool:    GolangciLintBinaryName,
+			File:    issue.Pos.Filename,
+			Line:    issue.Pos.Line,
+			Rule:    issue.FromLinter,
+			Message: issue.Text,
+		})
+	}
+
+	output, err = container.
+		WithExec([]string{GovulncheckBinaryName, "-format", "json", "./..."}).
+		Stdout(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to run govulncheck: %s", err)
+	}
+
+	summaries := map[string]string{}
+	reported := map[string]bool{}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	for {
+		message := govulncheckMessage{}
+
+		err := decoder.Decode(&message)
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse govulncheck output: %s", err)
+		}
+
+		if message.Osv != nil {
+			summaries[message.Osv.ID] = message.Osv.Summary
+		}
+
+		// Only vulnerable functions actually called by the project are reported
+		if message.Finding == nil || len(message.Finding.Trace) == 0 || message.Finding.Trace[0].Function == "" {
+			continue
+		}
+
+		// Trace goes from the vulnerable function to the project code calling it
+		caller := message.Finding.Trace[len(message.Finding.Trace)-1]
+
+		finding := &GolangLintFinding{
+			Tool: GovulncheckBinaryName,
+			Rule: message.Finding.Osv,
+		}
+
+		if caller.Position != nil {
+			finding.File = strings.TrimPrefix(caller.Position.Filename, SourceDir+"/")
+			finding.Line = caller.Position.Line
+		}
+
+		key := fmt.Sprintf("%s:%s:%d", finding.Rule, finding.File, finding.Line)
+
+		if reported[key] {
+			continue
+		}
+
+		reported[key] = true
+
+		finding.Message = fmt.Sprintf("%s (module %s", summaries[finding.Rule], message.Finding.Trace[0].Module)
+
+		if message.Finding.FixedVersion != "" {
+			finding.Message += ", fixed in " + message.Finding.FixedVersion
+		}
+
+		finding.Message += ")"
+
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// Lint a Go project and check that it does not call vulnerable dependencies
+// +check
+func (golang *Golang) Lint(
+	ctx context.Context,
+	// Go project source directory
+	// +defaultPath="/"
+	source *dagger.Directory,
+) error {
+	project, err := golang.Project(ctx, source)
+
+	if err != nil {
+		return fmt.Errorf("failed to get Go project: %s", err)
+	}
+
+	findings, err := project.LintFindings(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to get lint findings: %s", err)
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	lines := []string{}
+
+	for _, finding := range findings {
+		lines = append(lines, fmt.Sprintf("%s:%d: %s: %s", finding.File, finding.Line, finding.Rule, finding.Message))
+	}
+
+	return fmt.Errorf("%d lint findings:\n%s", len(findings), strings.Join(lines, "\n"))
+}
@@ -0,0 +1,308 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/golang/internal/dagger"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Location of Go project source directory
+	SourceDir string = "/src"
+
+	// Location of Go build outputs
+	OutputDir string = "/tmp/output"
+
+	// Name of Go test coverage profile file
+	CoverageProfileName string = "coverage.out"
+
+	// Name of Go test events file (as output by `go test -json`)
+	TestEventsName string = "test.json"
+)
+
+// Go project
+type GolangProject struct {
+	// +private
+	Golang *Golang
+	// +private
+	Source *dagger.Directory
+	// Get a Go container with mounted source directory
+	Container *dagger.Container
+}
+
+// Get a Go project from a source directory
+func (golang *Golang) Project(
+	ctx context.Context,
+	// Go project source directory
+	// +optional
+	// +defaultPath="/"
+	source *dagger.Directory,
+) (*GolangProject, error) {
+	container, err := golang.RedhatContainer(ctx, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Go container: %s", err)
+	}
+
+	container = container.
+		WithExec([]string{"mkdir", "-p", OutputDir}).
+		WithMountedDirectory(SourceDir, source).
+		WithWorkdir(SourceDir)
+
+	project := &GolangProject{
+		Golang:    golang,
+		Source:    source,
+		Container: container,
+	}
+
+	return project, nil
+}
+
+// Set an environment variable in the Go project
+func (project *GolangProject) WithEnvVariable(
+	// Environment variable name
+	name string,
+	// Environment variable value
+	value string,
+) *GolangProject {
+	project.Container = project.Container.
+		WithEnvVariable(name, value)
+
+	return project
+}
+
+// Go binary built for a platform
+type GolangBinary struct {
+	// Get the platform the binary is built for
+	Platform dagger.Platform
+	// Get the binary file
+	File *dagger.File
+}
+
+// Build a Go package of the project for given platforms
+func (project *GolangProject) Build(
+	ctx context.Context,
+	// Platforms to build the package for (defaults to the engine platform)
+	// +optional
+	platforms []dagger.Platform,
+	// Main package to build
+	// +optional
+	// +default="."
+	pkg string,
+	// Arguments to pass to Go build command
+	// +optional
+	args ...string,
+) ([]*GolangBinary, error) {
+	if len(platforms) == 0 {
+		platform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platforms = []dagger.Platform{platform}
+	}
+
+	binaries := []*GolangBinary{}
+
+	for _, platform := range platforms {
+		platformElements := strings.Split(string(platform), "/")
+
+		if len(platformElements) < 2 {
+			return nil, fmt.Errorf("invalid platform: %q", platform)
+		}
+
+		container := project.Container.
+			WithEnvVariable("GOOS", platformElements[0]).
+			WithEnvVariable("GOARCH", platformElements[1])
+
+		if len(platformElements) == 3 && platformElements[1] == "arm" {
+			container = container.
+				WithEnvVariable("GOARM", strings.TrimPrefix(platformElements[2], "v"))
+		}
+
+		command := append([]string{"go", "build", "-o", OutputDir + "/binary"}, args...)
+		command = append(command, pkg)
+
+		binary := &GolangBinary{
+			Platform: platform,
+			File:     container.WithExec(command).File(OutputDir + "/binary"),
+		}
+
+		binaries = append(binaries, binary)
+	}
+
+	return binaries, nil
+}
+
+// Go project test run
+type GolangTest struct {
+	// Get a Go container in which tests have been run
+	Container *dagger.Container
+	// +private
+	AllowFailures bool
+}
+
+// Test packages of the project
+//
+// Test failures are reported when the test run is synced and when reports are generated, unless failures are allowed so that reports of failed test runs can be generated.
+func (project *GolangProject) Test(
+	// Enable data race detection (packages are built with cgo)
+	// +optional
+	race bool,
+	// Packages to test
+	// +optional
+	// +default=["./..."]
+	packages []string,
+	// Generate reports even if tests fail (test failures are then only reported when the test run is synced)
+	// +optional
+	allowFailures bool,
+	// Arguments to pass to Go test command
+	// +optional
+	args ...string,
+) *GolangTest {
+	container := project.Container
+
+	if race {
+		container = container.
+			With(project.Golang.redhat().Packages([]string{"gcc"}).Installed).
+			WithEnvVariable("CGO_ENABLED", "1")
+	}
+
+	command := []string{"go", "test", "-json", "-coverprofile", OutputDir + "/" + CoverageProfileName}
+
+	if race {
+		command = append(command, "-race")
+	}
+
+	command = append(command, args...)
+	command = append(command, packages...)
+
+	test := &GolangTest{
+		Container: container.
+			WithExec(command, dagger.ContainerWithExecOpts{
+				RedirectStdout: OutputDir + "/" + TestEventsName,
+				Expect:         dagger.ReturnTypeAny,
+			}),
+		AllowFailures: allowFailures,
+	}
+
+	return test
+}
+
+// Get the coverage profile of the test run
+func (test *GolangTest) CoverageProfile(
+	ctx context.Context,
+) (*dagger.File, error) {
+	if err := test.reportable(ctx); err != nil {
+		return nil, err
+	}
+
+	return test.Container.File(OutputDir + "/" + CoverageProfileName), nil
+}
+
+// Vet packages of the project
+func (project *GolangProject) Vet(
+	// Packages to vet
+	// +optional
+	// +default=["./..."]
+	packages []string,
+	// Arguments to pass to Go vet command
+	// +optional
+	args ...string,
+) *GolangProject {
+	command := append([]string{"go", "vet"}, args...)
+	command = append(command, packages...)
+
+	project.Container = project.Container.
+		WithExec(command)
+
+	return project
+}
+
+// Get combined buffered standard output and standard error stream of the last executed command in the Go project container
+func (project *GolangProject) CombinedOutput(
+	ctx context.Context,
+) (string, error) {
+	return project.Container.CombinedOutput(ctx)
+}
+
+// Force evaluation of the Go project commands
+func (project *GolangProject) Sync(
+	ctx context.Context,
+) (*GolangProject, error) {
+	var err error
+
+	project.Container, err = project.Container.
+		Sync(ctx)
+
+	return project, err
+}
+
+// Get a minimal Red Hat Micro Universal Base Image container running a Go package of the project
+//
+// Package is built as a statically linked binary, with version information from Git set in a variable. Container runs the binary as a non-root user and has CA certificates.
+func (project *GolangProject) RuntimeContainer(
+	ctx context.Context,
+	// Main package to build
+	// +optional
+	// +default="."
+	pkg string,
+	// Name of the binary in the container
+	// +optional
+	// +default="app"
+	name string,
+	// Variable to set to the version from Git (`git describe`) at link time
+	// +optional
+	// +default="main.version"
+	versionVariable string,
+	// Platform to get container for
+	// +optional
+	platform dagger.Platform,
+) (*dagger.Container, error) {
+	if project.Golang.Fips && project.Golang.Version == "" {
+		return nil, errors.New("FIPS compliant binaries built with Red Hat Go cannot be statically linked, a Go version must be set")
+	}
+
+	version, err := project.Container.
+		WithExec([]string{"sh", "-c", "git -c safe.directory='*' describe --tags --always --dirty 2>/dev/null || echo dev"}).
+		Stdout(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version from Git: %s", err)
+	}
+
+	static := &GolangProject{
+		Golang:    project.Golang,
+		Source:    project.Source,
+		Container: project.Container.WithEnvVariable("CGO_ENABLED", "0"),
+	}
+
+	platforms := []dagger.Platform{}
+
+	if platform != "" {
+		platforms = append(platforms, platform)
+	}
+
+	binaries, err := static.Build(ctx, platforms, pkg, "-trimpath", "-ldflags", "-s -w -X "+versionVariable+"="+strings.TrimSpace(version))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Go package: %s", err)
+	}
+
+	redhat := project.Golang.redhat()
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: binaries[0].Platform}).
+		With(redhat.CaCertificates).
+		WithFile("/usr/local/bin/"+name, binaries[0].File).
+		With(redhat.Hardening().Hardened).
+		WithEntrypoint([]string{"/usr/local/bin/" + name}).
+		WithoutDefaultArgs()
+
+	return container, nil
+}
@@ -0,0 +1,585 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"dagger/golang/internal/dagger"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Name of JUnit test report file
+	JunitReportName string = "junit.xml"
+
+	// Name of Cobertura coverage report file
+	CoberturaReportName string = "cobertura.xml"
+
+	// Name of HTML coverage report file
+	HtmlReportName string = "coverage.html"
+)
+
+// Go test result
+type GolangTestResult struct {
+	// Get the package of the test
+	Package string
+	// Get the name of the test (empty for the package result)
+	Test string
+	// Get the status of the test (pass, fail or skip)
+	Status string
+	// Get the duration of the test in seconds
+	Duration float64
+	// Get the output of the test
+	Output string
+}
+
+// Go test event (as output by `go test -json`)
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// Get test events of the test run
+func (test *GolangTest) events(
+	ctx context.Context,
+) ([]testEvent, error) {
+	contents, err := test.Container.File(OutputDir + "/" + TestEventsName).Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test events: %s", err)
+	}
+
+	events := []testEvent{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	scanner.Buffer(nil, 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// Non-JSON lines are output by the Go toolchain, for instance build errors
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		event := testEvent{}
+
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse test event: %s", err)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test events: %s", err)
+	}
+
+	return events, nil
+}
+
+// Get test results of the test run
+func (test *GolangTest) Results(
+	ctx context.Context,
+) ([]*GolangTestResult, error) {
+	events, err := test.events(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*GolangTestResult{}
+	resultsByTest := map[[2]string]*GolangTestResult{}
+
+	for _, event := range events {
+		if event.Package == "" {
+			continue
+		}
+
+		key := [2]string{event.Package, event.Test}
+		result, ok := resultsByTest[key]
+
+		if !ok {
+			result = &GolangTestResult{
+				Package: event.Package,
+				Test:    event.Test,
+			}
+
+			resultsByTest[key] = result
+			results = append(results, result)
+		}
+
+		switch event.Action {
+		case "output":
+			result.Output += event.Output
+		case "pass", "fail", "skip":
+			result.Status = event.Action
+			result.Duration = event.Elapsed
+		}
+	}
+
+	return results, nil
+}
+
+// Get the output of the test run
+func (test *GolangTest) Output(
+	ctx context.Context,
+) (string, error) {
+	events, err := test.events(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	output := ""
+
+	for _, event := range events {
+		if event.Action == "output" || event.Action == "build-output" {
+			output += event.Output
+		}
+	}
+
+	return output, nil
+}
+
+// Get the exit code of Go test command (0 if tests passed)
+func (test *GolangTest) ExitCode(
+	ctx context.Context,
+) (int, error) {
+	exitCode, err := test.Container.ExitCode(ctx)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to run tests: %s", err)
+	}
+
+	return exitCode, nil
+}
+
+// Check that reports of the test run can be generated
+//
+// An error listing failed tests is returned if tests failed, unless failures are allowed.
+func (test *GolangTest) reportable(
+	ctx context.Context,
+) error {
+	if test.AllowFailures {
+		return nil
+	}
+
+	_, err := test.Sync(ctx)
+
+	return err
+}
+
+// Force evaluation of the test run
+//
+// An error listing failed tests is returned if tests failed.
+func (test *GolangTest) Sync(
+	ctx context.Context,
+) (*GolangTest, error) {
+	exitCode, err := test.ExitCode(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exitCode == 0 {
+		return test, nil
+	}
+
+	results, err := test.Results(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test results: %s", err)
+	}
+
+	failures := []string{}
+
+	for _, result := range results {
+		if result.Status != "fail" {
+			continue
+		}
+
+		if result.Test == "" {
+			failures = append(failures, result.Package)
+		} else {
+			failures = append(failures, result.Package+"."+result.Test)
+		}
+	}
+
+	return nil, fmt.Errorf("tests failed: %s", strings.Join(failures, ", "))
+}
+
+// JUnit test suites
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+// JUnit test suite
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+// JUnit test case
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// JUnit test case failure
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// JUnit test case skip
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Format a duration in seconds for reports
+func reportDuration(duration float64) string {
+	return strconv.FormatFloat(duration, 'f', 3, 64)
+}
+
+// Get a JUnit XML report of the test run
+//
+// Packages failing without a failed test (for instance because of a build failure) are reported as a failed test case named after the package.
+func (test *GolangTest) Junit(
+	ctx context.Context,
+) (*dagger.File, error) {
+	if err := test.reportable(ctx); err != nil {
+		return nil, err
+	}
+
+	results, err := test.Results(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test results: %s", err)
+	}
+
+	report := junitTestSuites{}
+	testSuites := map[string]*junitTestSuite{}
+	packageResults := map[string]*GolangTestResult{}
+	packages := []string{}
+	duration := 0.0
+
+	for _, result := range results {
+		testSuite, ok := testSuites[result.Package]
+
+		if !ok {
+			testSuite = &junitTestSuite{
+				Name: result.Package,
+			}
+
+			testSuites[result.Package] = testSuite
+			packages = append(packages, result.Package)
+		}
+
+		if result.Test == "" {
+			packageResults[result.Package] = result
+
+			continue
+		}
+
+		testCase := junitTestCase{
+			ClassName: result.Package,
+			Name:      result.Test,
+			Time:      reportDuration(result.Duration),
+		}
+
+		switch result.Status {
+		case "fail":
+			testCase.Failure = &junitFailure{
+				Message: "Failed",
+				Output:  result.Output,
+			}
+
+			testSuite.Failures++
+		case "skip":
+			testCase.Skipped = &junitSkipped{
+				Message: "Skipped",
+			}
+			testCase.SystemOut = result.Output
+
+			testSuite.Skipped++
+		default:
+			testCase.SystemOut = result.Output
+		}
+
+		testSuite.TestCases = append(testSuite.TestCases, testCase)
+		testSuite.Tests++
+	}
+
+	for _, name := range packages {
+		testSuite := testSuites[name]
+
+		if result, ok := packageResults[name]; ok {
+			testSuite.Time = reportDuration(result.Duration)
+			testSuite.SystemOut = result.Output
+			duration += result.Duration
+
+			if result.Status == "fail" && testSuite.Failures == 0 {
+				testSuite.TestCases = append(testSuite.TestCases, junitTestCase{
+					ClassName: name,
+					Name:      path.Base(name),
+					Time:      reportDuration(result.Duration),
+					Failure: &junitFailure{
+						Message: "Failed",
+						Output:  result.Output,
+					},
+				})
+
+				testSuite.Failures++
+				testSuite.Tests++
+			}
+		}
+
+		report.Tests += testSuite.Tests
+		report.Failures += testSuite.Failures
+		report.Skipped += testSuite.Skipped
+		report.TestSuites = append(report.TestSuites, *testSuite)
+	}
+
+	report.Time = reportDuration(duration)
+
+	contents, err := xml.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JUnit report: %s", err)
+	}
+
+	return dag.Directory().WithNewFile(JunitReportName, xml.Header+string(contents)+"\n").File(JunitReportName), nil
+}
+
+// Cobertura coverage report
+type coberturaCoverage struct {
+	XMLName      xml.Name           `xml:"coverage"`
+	LineRate     string             `xml:"line-rate,attr"`
+	BranchRate   string             `xml:"branch-rate,attr"`
+	LinesCovered int                `xml:"lines-covered,attr"`
+	LinesValid   int                `xml:"lines-valid,attr"`
+	Complexity   string             `xml:"complexity,attr"`
+	Version      string             `xml:"version,attr"`
+	Timestamp    int64              `xml:"timestamp,attr"`
+	Sources      []string           `xml:"sources>source"`
+	Packages     []coberturaPackage `xml:"packages>package"`
+}
+
+// Cobertura package coverage
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity string           `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+// Cobertura class (Go source file) coverage
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity string          `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+// Cobertura line coverage
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// Format a coverage rate for reports
+func coverageRate(covered int, valid int) string {
+	if valid == 0 {
+		return "0"
+	}
+
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
+
+// Get a Cobertura XML coverage report of the test run
+//
+// Source files are reported relatively to the Go module root directory.
+func (test *GolangTest) Cobertura(
+	ctx context.Context,
+) (*dagger.File, error) {
+	coverageProfile, err := test.CoverageProfile(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := coverageProfile.Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage profile: %s", err)
+	}
+
+	goMod, err := test.Container.File(SourceDir + "/go.mod").Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.mod file: %s", err)
+	}
+
+	module := ""
+
+	if match := regexp.MustCompile(`(?m)^module\s+(\S+)\s*$`).FindStringSubmatch(goMod); match != nil {
+		module = strings.Trim(match[1], `"`)
+	}
+
+	// Report is reproducible, its timestamp is set from SOURCE_DATE_EPOCH environment variable if set, 0 otherwise
+	sourceDateEpoch, err := test.Container.EnvVariable(ctx, "SOURCE_DATE_EPOCH")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOURCE_DATE_EPOCH environment variable: %s", err)
+	}
+
+	timestamp, _ := strconv.ParseInt(sourceDateEpoch, 10, 64)
+
+	blockRegexp := regexp.MustCompile(`^(.+):(\d+)\.\d+,(\d+)\.\d+ \d+ (\d+)$`)
+
+	// Hits of each line of each file, by package
+	hits := map[string]map[string]map[int]int{}
+
+	for _, line := range strings.Split(profile, "\n") {
+		match := blockRegexp.FindStringSubmatch(line)
+
+		if match == nil {
+			continue
+		}
+
+		file := match[1]
+		startLine, _ := strconv.Atoi(match[2])
+		endLine, _ := strconv.Atoi(match[3])
+		count, _ := strconv.Atoi(match[4])
+
+		pkg := path.Dir(file)
+
+		if hits[pkg] == nil {
+			hits[pkg] = map[string]map[int]int{}
+		}
+
+		if hits[pkg][file] == nil {
+			hits[pkg][file] = map[int]int{}
+		}
+
+		for number := startLine; number <= endLine; number++ {
+			hits[pkg][file][number] = max(hits[pkg][file][number], count)
+		}
+	}
+
+	report := coberturaCoverage{
+		BranchRate: "0",
+		Complexity: "0",
+		Version:    "1.9",
+		Timestamp:  timestamp * 1000,
+		Sources:    []string{"."},
+	}
+
+	for _, pkg := range slices.Sorted(maps.Keys(hits)) {
+		coberturaPkg := coberturaPackage{
+			Name:       pkg,
+			BranchRate: "0",
+			Complexity: "0",
+		}
+
+		pkgCovered := 0
+		pkgValid := 0
+
+		for _, file := range slices.Sorted(maps.Keys(hits[pkg])) {
+			filename := file
+
+			if module != "" {
+				filename = strings.TrimPrefix(strings.TrimPrefix(file, module), "/")
+			}
+
+			class := coberturaClass{
+				Name:       path.Base(file),
+				Filename:   filename,
+				BranchRate: "0",
+				Complexity: "0",
+			}
+
+			covered := 0
+
+			for _, number := range slices.Sorted(maps.Keys(hits[pkg][file])) {
+				class.Lines = append(class.Lines, coberturaLine{
+					Number: number,
+					Hits:   hits[pkg][file][number],
+				})
+
+				if hits[pkg][file][number] > 0 {
+					covered++
+				}
+			}
+
+			class.LineRate = coverageRate(covered, len(class.Lines))
+			coberturaPkg.Classes = append(coberturaPkg.Classes, class)
+
+			pkgCovered += covered
+			pkgValid += len(class.Lines)
+		}
+
+		coberturaPkg.LineRate = coverageRate(pkgCovered, pkgValid)
+		report.Packages = append(report.Packages, coberturaPkg)
+
+		report.LinesCovered += pkgCovered
+		report.LinesValid += pkgValid
+	}
+
+	report.LineRate = coverageRate(report.LinesCovered, report.LinesValid)
+
+	contents, err := xml.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Cobertura report: %s", err)
+	}
+
+	return dag.Directory().WithNewFile(CoberturaReportName, xml.Header+string(contents)+"\n").File(CoberturaReportName), nil
+}
+
+// Get an HTML coverage report of the test run
+func (test *GolangTest) Html(
+	ctx context.Context,
+) (*dagger.File, error) {
+	if err := test.reportable(ctx); err != nil {
+		return nil, err
+	}
+
+	report := test.Container.
+		WithExec([]string{"go", "tool", "cover", "-html", OutputDir + "/" + CoverageProfileName, "-o", OutputDir + "/" + HtmlReportName}).
+		File(OutputDir + "/" + HtmlReportName)
+
+	return report, nil
+}
@@ -0,0 +1,114 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/golang/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// Go build reproducibility verification result
+type GolangReproducibility struct {
+	// Get whether both builds produced identical binaries
+	Reproducible bool
+	// Get the digest of the first build binary
+	FirstDigest string
+	// Get the digest of the second build binary
+	SecondDigest string
+	// Get the differences between build information (as output by `go version -m`) of both binaries, empty if identical
+	BuildInfoDiff string
+}
+
+// Build a Go package of the project in a given isolated working directory, with source files modified at a given time
+func (project *GolangProject) isolatedBuild(
+	workdir string,
+	timestamp string,
+	platform dagger.Platform,
+	pkg string,
+	args []string,
+) *dagger.File {
+	platformElements := strings.Split(string(platform), "/")
+
+	container := project.Container.
+		WithDirectory(workdir, project.Source).
+		WithWorkdir(workdir).
+		WithExec([]string{"find", ".", "-exec", "touch", "--no-dereference", "--date", timestamp, "{}", "+"}).
+		WithEnvVariable("GOCACHE", workdir+"-cache").
+		WithEnvVariable("GOOS", platformElements[0]).
+		WithEnvVariable("GOARCH", platformElements[1])
+
+	if len(platformElements) == 3 && platformElements[1] == "arm" {
+		container = container.
+			WithEnvVariable("GOARM", strings.TrimPrefix(platformElements[2], "v"))
+	}
+
+	command := append([]string{"go", "build", "-trimpath", "-o", OutputDir + "/binary"}, args...)
+	command = append(command, pkg)
+
+	return container.
+		WithExec(command).
+		File(OutputDir + "/binary")
+}
+
+// Verify that a Go package of the project builds reproducibly
+//
+// Package is built twice in isolated working directories, with empty build caches and different source files modification times. Builds use `-trimpath` so that binaries do not depend on working directories.
+func (project *GolangProject) Reproducibility(
+	ctx context.Context,
+	// Main package to build
+	// +optional
+	// +default="."
+	pkg string,
+	// Platform to build the package for (defaults to the engine platform)
+	// +optional
+	platform dagger.Platform,
+	// Arguments to pass to Go build command
+	// +optional
+	args ...string,
+) (*GolangReproducibility, error) {
+	if platform == "" {
+		defaultPlatform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platform = defaultPlatform
+	}
+
+	first := project.isolatedBuild("/tmp/first/src", "2000-01-01T00:00:00Z", platform, pkg, args)
+	second := project.isolatedBuild("/tmp/second/build/src", "2020-12-31T23:59:59Z", platform, pkg, args)
+
+	reproducibility := &GolangReproducibility{}
+
+	var err error
+
+	reproducibility.FirstDigest, err = first.Digest(ctx, dagger.FileDigestOpts{ExcludeMetadata: true})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get first build binary digest: %s", err)
+	}
+
+	reproducibility.SecondDigest, err = second.Digest(ctx, dagger.FileDigestOpts{ExcludeMetadata: true})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get second build binary digest: %s", err)
+	}
+
+	reproducibility.Reproducible = reproducibility.FirstDigest == reproducibility.SecondDigest
+
+	reproducibility.BuildInfoDiff, err = project.Container.
+		WithMountedFile("/tmp/first/binary", first).
+		WithMountedFile("/tmp/second/binary", second).
+		WithExec([]string{"sh", "-c", "(cd /tmp/first && go version -m binary) > /tmp/first.txt && (cd /tmp/second && go version -m binary) > /tmp/second.txt && { diff --unified --label first --label second /tmp/first.txt /tmp/second.txt || true; }"}).
+		Stdout(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare build information: %s", err)
+	}
+
+	return reproducibility, nil
+}
@@ -0,0 +1,189 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/golang/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// URL to download Go releases from
+	DownloadURL string = "https://go.dev/dl"
+)
+
+// Go release as listed in the release manifest
+type release struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		Sha256   string `json:"sha256"`
+	} `json:"files"`
+}
+
+// Get SHA-256 checksum of a Go release file from the release manifest
+func (golang *Golang) checksum(
+	ctx context.Context,
+	filename string,
+) (string, error) {
+	manifest, err := dag.HTTP(DownloadURL + "/?mode=json&include=all").Contents(ctx)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get release manifest: %s", err)
+	}
+
+	releases := []release{}
+
+	if err := json.Unmarshal([]byte(manifest), &releases); err != nil {
+		return "", fmt.Errorf("failed to parse release manifest: %s", err)
+	}
+
+	for _, release := range releases {
+		if release.Version != "go"+golang.Version {
+			continue
+		}
+
+		for _, file := range release.Files {
+			if file.Filename == filename {
+				return file.Sha256, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("release file not found in release manifest: %s", filename)
+}
+
+// Get a root filesystem overlay with Go
+func (golang *Golang) Overlay(
+	ctx context.Context,
+	// Platform to get Go for
+	// +optional
+	platform dagger.Platform,
+	// Filesystem prefix under which to install Go
+	// +optional
+	prefix string,
+) (*dagger.Directory, error) {
+	if golang.Version == "" {
+		return nil, errors.New("Go version must be set to get Go from upstream tarballs")
+	}
+
+	if prefix == "" {
+		prefix = "/usr/local"
+	}
+
+	if platform == "" {
+		defaultPlatform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platform = defaultPlatform
+	}
+
+	platformElements := strings.Split(string(platform), "/")
+
+	os := platformElements[0]
+	arch := platformElements[1]
+
+	if arch == "arm" {
+		arch = "armv6l"
+	}
+
+	archiveName := fmt.Sprintf("go%s.%s-%s.tar.gz", golang.Version, os, arch)
+
+	checksum, err := golang.checksum(ctx, archiveName)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Go archive checksum: %s", err)
+	}
+
+	archive := dag.HTTP(DownloadURL + "/" + archiveName)
+
+	// Executables are linked in the binaries directory, Go finds its root directory by resolving links
+	container := golang.redhat().Container().
+		WithMountedFile(archiveName, archive).
+		WithExec([]string{"sh", "-c", "echo '" + checksum + "  " + archiveName + "' | sha256sum -c"}).
+		WithExec([]string{"mkdir", "-p", "/tmp/overlay/bin"}).
+		WithExec([]string{"tar", "--extract", "--file", archiveName, "--directory", "/tmp/overlay"}).
+		WithExec([]string{"ln", "-s", "../go/bin/go", "/tmp/overlay/bin/go"}).
+		WithExec([]string{"ln", "-s", "../go/bin/gofmt", "/tmp/overlay/bin/gofmt"})
+
+	overlay := dag.Directory().
+		WithDirectory(prefix, container.Directory("/tmp/overlay"))
+
+	return overlay, nil
+}
+
+// Install Go in a container from upstream tarballs
+func (golang *Golang) Installation(
+	ctx context.Context,
+	// Container in which to install Go
+	container *dagger.Container,
+) (*dagger.Container, error) {
+	platform, err := container.Platform(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container platform: %s", err)
+	}
+
+	overlay, err := golang.Overlay(ctx, platform, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Go overlay: %s", err)
+	}
+
+	container, err = golang.Configuration(ctx, container.WithDirectory("/", overlay))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Go: %s", err)
+	}
+
+	return container, nil
+}
+
+// Get Go with the version required by a Go module
+//
+// Version is read from the `toolchain` directive of the `go.mod` file, or from its `go` directive otherwise.
+func (golang *Golang) WithModuleToolchain(
+	ctx context.Context,
+	// Go module source directory
+	source *dagger.Directory,
+) (*Golang, error) {
+	goMod, err := source.File("go.mod").Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.mod file: %s", err)
+	}
+
+	version := ""
+
+	if match := regexp.MustCompile(`(?m)^toolchain\s+go(\S+)\s*$`).FindStringSubmatch(goMod); match != nil {
+		version = match[1]
+	} else if match := regexp.MustCompile(`(?m)^go\s+(\S+)\s*$`).FindStringSubmatch(goMod); match != nil {
+		version = match[1]
+
+		// Since Go 1.21, first releases of a language version are numbered with a 0 patch version
+		versionElements := strings.Split(version, ".")
+
+		if len(versionElements) == 2 {
+			if minor, err := strconv.Atoi(versionElements[1]); err == nil && minor >= 21 {
+				version += ".0"
+			}
+		}
+	} else {
+		return nil, errors.New("no go or toolchain directive found in go.mod file")
+	}
+
+	module := *golang
+	module.Version = version
+
+	return &module, nil
+}
@@ -29,6 +29,8 @@ type Hugo struct {
 	Version string
 	// +private
 	Extended bool
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // Hugo constructor
@@ -38,10 +40,14 @@ func New(
 	// Hugo edition to get
 	// +optional
 	extended bool,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with Hugo
+	// +optional
+	caCertificates []*dagger.File,
 ) *Hugo {
 	hugo := &Hugo{
-		Version:  version,
-		Extended: extended,
+		Version:        version,
+		Extended:       extended,
+		CaCertificates: caCertificates,
 	}
 
 	return hugo
@@ -181,7 +187,9 @@ func (hugo *Hugo) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform}).
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: hugo.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform}).
 		With(dag.Golang().RedhatInstallation)
 
 	return hugo.Container(ctx, container)
@@ -194,7 +202,9 @@ func (hugo *Hugo) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: hugo.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
 		With(dag.Golang().RedhatMinimalInstallation)
 
 	return hugo.Container(ctx, container)
@@ -213,7 +223,9 @@ func (hugo *Hugo) RedhatMicroContainer(
 		return nil, errors.New("extended version is not compatible with Red Hat micro container")
 	}
 
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: hugo.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
 
 	return hugo.Container(ctx, container)
 }
@@ -23,15 +23,21 @@ const (
 type Jq struct {
 	// +private
 	Version string
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // jq constructor
 func New(
 	// jq version to get
 	version string,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with jq
+	// +optional
+	caCertificates []*dagger.File,
 ) *Jq {
 	jq := &Jq{
-		Version: version,
+		Version:        version,
+		CaCertificates: caCertificates,
 	}
 
 	return jq
@@ -174,7 +180,9 @@ func (jq *Jq) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: jq.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform})
 
 	return jq.Container(ctx, container)
 }
@@ -186,7 +194,9 @@ func (jq *Jq) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: jq.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
 
 	return jq.Container(ctx, container)
 }
@@ -198,7 +208,9 @@ func (jq *Jq) RedhatMicroContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: jq.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
 
 	return jq.Container(ctx, container)
 }
@@ -51,3 +51,23 @@ func (*Kroki) Container(
 func (kroki *Kroki) Server() *dagger.Service {
 	return kroki.Container("").AsService(dagger.ContainerAsServiceOpts{UseEntrypoint: true})
 }
+
+// Get a changeset updating the pinned Kroki container image to its latest tag
+// +cache="never"
+func (*Kroki) Update(
+	// Registry to query instead of the registry of the pinned image (can be used to query a mirror or a local registry)
+	// +optional
+	registry string,
+	// Service providing the registry to query
+	// +optional
+	registryService *dagger.Service,
+	// Query the registry without verifying TLS certificates or over plain HTTP
+	// +optional
+	insecure bool,
+) *dagger.Changeset {
+	return dag.Redhat().ImageUpdates(dag.CurrentModule().Source(), dagger.RedhatImageUpdatesOpts{
+		Registry:        registry,
+		RegistryService: registryService,
+		Insecure:        insecure,
+	})
+}
@@ -0,0 +1,265 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Vulnerability severities rank
+var severities = map[string]int{
+	"info":     0,
+	"low":      1,
+	"moderate": 2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Vulnerability of a Node.js project dependency
+type NodejsVulnerability struct {
+	// Name of the vulnerable package
+	Package string
+	// Installed version of the package
+	Version string
+	// Advisory identifier
+	Id string
+	// Advisory title
+	Title string
+	// Severity (info, low, moderate, high or critical)
+	Severity string
+	// Advisory URL
+	Url string
+	// Vulnerable versions range of the package
+	VulnerableVersions string
+}
+
+// License of a Node.js project dependency
+type NodejsLicense struct {
+	// Name of the package
+	Package string
+	// Installed version of the package
+	Version string
+	// License of the package (as a SPDX license expression)
+	License string
+	// Location of the package in the project
+	Path string
+	// Whether the license is disallowed
+	Disallowed bool
+}
+
+// Run the audit script on the installed dependencies of the Node.js project
+func (project *NodejsProject) audit(
+	ctx context.Context,
+	mode string,
+	advisories *dagger.File,
+	result any,
+) error {
+	const scriptName = "audit.js"
+
+	container := project.Container.
+		WithMountedFile("/tmp/"+scriptName, dag.CurrentModule().Source().File(scriptName))
+
+	command := []string{"node", "/tmp/" + scriptName, mode, SourceDir}
+
+	if advisories != nil {
+		container = container.
+			WithMountedFile("/tmp/advisories.json", advisories)
+
+		command = append(command, "/tmp/advisories.json")
+	}
+
+	output, err := container.
+		WithExec(command).
+		Stdout(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to run audit script: %s", err)
+	}
+
+	if err := json.Unmarshal([]byte(output), result); err != nil {
+		return fmt.Errorf("failed to parse audit script output: %s", err)
+	}
+
+	return nil
+}
+
+// Get vulnerabilities of the installed dependencies of the Node.js project
+//
+// Installed packages are matched against advisories the way npm audit does, advisories are fetched from npm registry unless an advisories file is given.
+func (project *NodejsProject) Vulnerabilities(
+	ctx context.Context,
+	// Advisories file to use instead of npm registry, for offline use (formatted as npm bulk advisories endpoint responses, as `{"package": [{"id": …, "title": …, "severity": …, "url": …, "vulnerable_versions": …}]}`)
+	// +optional
+	advisories *dagger.File,
+	// Fail if a vulnerability of this severity or higher is found (info, low, moderate, high or critical)
+	// +optional
+	failOn string,
+) ([]*NodejsVulnerability, error) {
+	if failOn != "" {
+		if _, ok := severities[strings.ToLower(failOn)]; !ok {
+			return nil, fmt.Errorf("unknown severity: %q", failOn)
+		}
+	}
+
+	vulnerabilities := []*NodejsVulnerability{}
+
+	if err := project.audit(ctx, "vulnerabilities", advisories, &vulnerabilities); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(vulnerabilities, func(a, b *NodejsVulnerability) int {
+		return cmp.Or(
+			cmp.Compare(severities[b.Severity], severities[a.Severity]),
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(a.Id, b.Id),
+		)
+	})
+
+	if failOn != "" {
+		failing := []string{}
+
+		for _, vulnerability := range vulnerabilities {
+			if severities[vulnerability.Severity] >= severities[strings.ToLower(failOn)] {
+				failing = append(failing, fmt.Sprintf("%s (%s) in %s %s: %s", vulnerability.Id, vulnerability.Severity, vulnerability.Package, vulnerability.Version, vulnerability.Title))
+			}
+		}
+
+		if len(failing) > 0 {
+			return nil, fmt.Errorf("found %d vulnerabilities of %s severity or higher:\n%s", len(failing), strings.ToLower(failOn), strings.Join(failing, "\n"))
+		}
+	}
+
+	return vulnerabilities, nil
+}
+
+// Check whether a SPDX license expression only allows disallowed licenses
+//
+// Expression is allowed if one of its `OR` alternatives does not contain a disallowed license.
+func disallowedLicense(expression string, disallowed []string) bool {
+	if len(disallowed) == 0 {
+		return false
+	}
+
+	expression = strings.NewReplacer("(", " ", ")", " ").Replace(expression)
+
+	for _, alternative := range regexp.MustCompile(`\s+OR\s+`).Split(expression, -1) {
+		allowed := true
+
+		for _, license := range regexp.MustCompile(`\s+(?:AND|WITH)\s+`).Split(strings.TrimSpace(alternative), -1) {
+			if slices.ContainsFunc(disallowed, func(disallowedLicense string) bool {
+				return strings.EqualFold(disallowedLicense, strings.TrimSuffix(license, "+"))
+			}) {
+				allowed = false
+			}
+		}
+
+		if allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get licenses of the installed dependencies of the Node.js project
+func (project *NodejsProject) Licenses(
+	ctx context.Context,
+	// Disallowed licenses (as SPDX license identifiers)
+	// +optional
+	disallowed []string,
+	// Fail if a dependency has a disallowed license
+	// +optional
+	failOnDisallowed bool,
+) ([]*NodejsLicense, error) {
+	packages := []struct {
+		Name    string
+		Version string
+		License string
+		Path    string
+	}{}
+
+	if err := project.audit(ctx, "licenses", nil, &packages); err != nil {
+		return nil, err
+	}
+
+	licenses := []*NodejsLicense{}
+	failing := []string{}
+
+	for _, installed := range packages {
+		license := &NodejsLicense{
+			Package:    installed.Name,
+			Version:    installed.Version,
+			License:    installed.License,
+			Path:       installed.Path,
+			Disallowed: disallowedLicense(installed.License, disallowed),
+		}
+
+		if license.Disallowed {
+			failing = append(failing, fmt.Sprintf("%s %s: %s", license.Package, license.Version, license.License))
+		}
+
+		licenses = append(licenses, license)
+	}
+
+	slices.SortFunc(licenses, func(a, b *NodejsLicense) int {
+		return cmp.Or(
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(a.Version, b.Version),
+		)
+	})
+
+	if failOnDisallowed && len(failing) > 0 {
+		slices.Sort(failing)
+
+		return nil, fmt.Errorf("found %d dependencies with disallowed licenses:\n%s", len(failing), strings.Join(failing, "\n"))
+	}
+
+	return licenses, nil
+}
+
+// Check that a Node.js project has no vulnerable dependencies and no dependencies with disallowed licenses
+//
+// Dependencies must be installed in `node_modules` directories, projects using Yarn Plug'n'Play linker are not supported.
+// +check
+func (nodejs *Nodejs) Audit(
+	ctx context.Context,
+	// Project source directory
+	// +defaultPath="/"
+	// +ignore=["node_modules"]
+	source *dagger.Directory,
+	// Advisories file to use instead of npm registry, for offline use (see `vulnerabilities` function of projects)
+	// +optional
+	advisories *dagger.File,
+	// Fail if a vulnerability of this severity or higher is found (info, low, moderate, high or critical)
+	// +optional
+	// +default="high"
+	failOn string,
+	// Disallowed licenses (as SPDX license identifiers)
+	// +optional
+	// +default=["SSPL-1.0", "BUSL-1.1", "Elastic-2.0", "CC-BY-NC-4.0", "CC-BY-NC-SA-4.0", "CC-BY-NC-ND-4.0"]
+	disallowedLicenses []string,
+) error {
+	project, err := nodejs.Project(ctx, source, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to get Node.js project: %s", err)
+	}
+
+	if _, err := project.Vulnerabilities(ctx, advisories, failOn); err != nil {
+		return err
+	}
+
+	if _, err := project.Licenses(ctx, disallowedLicenses, true); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Inventory of the packages installed in a Node.js project, with their licenses or their vulnerabilities
+//
+// Usage: node audit.js licenses <project directory>
+//        node audit.js vulnerabilities <project directory> [advisories file]
+//
+// Advisories file is formatted as npm bulk advisories endpoint responses, advisories are fetched from npm registry if not given.
+
+'use strict';
+
+const fs = require('fs');
+const path = require('path');
+
+// Get the installation directory of npm, which is not under the global prefix when npm is installed from packages
+function npmDirectory() {
+  for (const directory of (process.env.PATH || '').split(path.delimiter)) {
+    try {
+      // npm executable is a link to bin/npm-cli.js in the installation directory
+      const cli = fs.realpathSync(path.join(directory, 'npm'));
+
+      if (path.basename(cli) === 'npm-cli.js') {
+        return path.dirname(path.dirname(cli));
+      }
+    } catch {
+      continue;
+    }
+  }
+
+  return path.resolve(path.dirname(process.execPath), '..', 'lib', 'node_modules', 'npm');
+}
+
+// Use semver package bundled with npm to match versions the way npm does
+const semver = require(path.join(npmDirectory(), 'node_modules', 'semver'));
+
+const advisoriesURL = 'https://registry.npmjs.org/-/npm/v1/security/advisories/bulk';
+
+function license(manifest) {
+  if (typeof manifest.license === 'string') {
+    return manifest.license;
+  }
+
+  if (manifest.license && manifest.license.type) {
+    return manifest.license.type;
+  }
+
+  if (Array.isArray(manifest.licenses)) {
+    return manifest.licenses.map((license) => license.type || license).join(' OR ');
+  }
+
+  return '';
+}
+
+function directories(directory) {
+  try {
+    // Links are not followed, as they point to packages installed elsewhere or to workspaces
+    return fs.readdirSync(directory, { withFileTypes: true }).filter((entry) => entry.isDirectory()).map((entry) => entry.name);
+  } catch {
+    return [];
+  }
+}
+
+function scan(nodeModules, root, packages) {
+  for (const name of directories(nodeModules)) {
+    const directory = path.join(nodeModules, name);
+
+    if (name === '.bin') {
+      continue;
+    }
+
+    if (name === '.pnpm') {
+      for (const store of directories(directory)) {
+        scan(path.join(directory, store, 'node_modules'), root, packages);
+      }
+    } else if (name.startsWith('@')) {
+      for (const scoped of directories(directory)) {
+        visit(path.join(directory, scoped), root, packages);
+      }
+    } else {
+      visit(directory, root, packages);
+    }
+  }
+}
+
+function visit(directory, root, packages) {
+  let manifest;
+
+  try {
+    manifest = JSON.parse(fs.readFileSync(path.join(directory, 'package.json')));
+  } catch {
+    return;
+  }
+
+  if (manifest.name && manifest.version && !packages.has(`${manifest.name}@${manifest.version}`)) {
+    packages.set(`${manifest.name}@${manifest.version}`, {
+      name: manifest.name,
+      version: manifest.version,
+      license: license(manifest),
+      path: path.relative(root, directory),
+    });
+  }
+
+  scan(path.join(directory, 'node_modules'), root, packages);
+}
+
+async function vulnerabilities(packages, advisoriesFile) {
+  const versions = {};
+
+  for (const installed of packages) {
+    versions[installed.name] = [...(versions[installed.name] || []), installed.version];
+  }
+
+  let advisories;
+
+  if (advisoriesFile) {
+    advisories = JSON.parse(fs.readFileSync(advisoriesFile));
+  } else {
+    const response = await fetch(advisoriesURL, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(versions),
+    });
+
+    if (!response.ok) {
+      throw new Error(`failed to fetch advisories: ${response.status} ${response.statusText}`);
+    }
+
+    advisories = await response.json();
+  }
+
+  const found = [];
+
+  for (const [name, packageAdvisories] of Object.entries(advisories)) {
+    for (const advisory of packageAdvisories) {
+      for (const version of versions[name] || []) {
+        if (semver.satisfies(version, advisory.vulnerable_versions, { includePrerelease: true })) {
+          found.push({
+            package: name,
+            version: version,
+            id: String(advisory.github_advisory_id || advisory.id),
+            title: advisory.title,
+            severity: advisory.severity,
+            url: advisory.url,
+            vulnerableVersions: advisory.vulnerable_versions,
+          });
+        }
+      }
+    }
+  }
+
+  return found;
+}
+
+async function main() {
+  const [mode, root, advisoriesFile] = process.argv.slice(2);
+
+  // Packages installed by Yarn Plug'n'Play linker are not in node_modules, auditing would silently find none
+  if (fs.existsSync(path.join(root, '.pnp.cjs'))) {
+    throw new Error("projects installed with Yarn Plug'n'Play linker are not supported, set nodeLinker to node-modules in .yarnrc.yml");
+  }
+
+  const packages = new Map();
+  scan(path.join(root, 'node_modules'), root, packages);
+
+  if (mode === 'licenses') {
+    process.stdout.write(JSON.stringify([...packages.values()]));
+  } else if (mode === 'vulnerabilities') {
+    process.stdout.write(JSON.stringify(await vulnerabilities([...packages.values()], advisoriesFile)));
+  } else {
+    throw new Error(`unknown mode: ${mode}`);
+  }
+}
+
+main().catch((error) => {
+  console.error(error.message);
+  process.exit(1);
+});
@@ -0,0 +1,129 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// Location of Playwright browsers
+	BrowsersDir string = "/opt/ms-playwright"
+
+	// Location of Playwright browsers downloads cache
+	BrowsersCacheDir string = "/var/cache/ms-playwright"
+
+	// Playwright version to install globally
+	PlaywrightVersion string = "1.56.1"
+)
+
+// Get Red Hat packages of system libraries required by browsers
+func (nodejs *Nodejs) browsersRedhatPackages() []string {
+	if len(nodejs.Browsers) == 0 {
+		return nil
+	}
+
+	packages := []string{
+		"alsa-lib",
+		"cairo",
+		"dbus-libs",
+		"dejavu-sans-fonts",
+		"fontconfig",
+		"libX11",
+		"libXcomposite",
+		"libXdamage",
+		"libXext",
+		"libXfixes",
+		"libXrandr",
+		"libxcb",
+		"libxkbcommon",
+		"mesa-libgbm",
+		"nspr",
+		"nss",
+		"pango",
+	}
+
+	for _, browser := range nodejs.Browsers {
+		switch {
+		case strings.HasPrefix(browser, "chromium"):
+			packages = append(packages,
+				"at-spi2-atk",
+				"atk",
+				"cups-libs",
+				"libdrm",
+			)
+		case browser == "firefox":
+			packages = append(packages,
+				"dbus-glib",
+				"gtk3",
+				"libXcursor",
+				"libXi",
+				"libXt",
+			)
+		}
+	}
+
+	slices.Sort(packages)
+
+	return slices.Compact(packages)
+}
+
+// Configure Playwright browsers location in a container
+func (nodejs *Nodejs) browsersConfiguration(
+	container *dagger.Container,
+) *dagger.Container {
+	if len(nodejs.Browsers) == 0 {
+		return container
+	}
+
+	return container.
+		WithEnvVariable("PLAYWRIGHT_BROWSERS_PATH", BrowsersDir)
+}
+
+// Install Playwright globally with its browsers in a container
+//
+// Browsers are downloaded in a cache volume specific to the Playwright version and to the platform of the container, and are then copied to the container.
+func (nodejs *Nodejs) browsersInstallation(
+	ctx context.Context,
+	container *dagger.Container,
+) (*dagger.Container, error) {
+	if len(nodejs.Browsers) == 0 {
+		return container, nil
+	}
+
+	platform, err := container.Platform(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container platform: %s", err)
+	}
+
+	cacheKey := regexp.MustCompile(`[^A-Za-z0-9._]+`).ReplaceAllString(PlaywrightVersion+"-"+string(platform), "-")
+
+	container = container.
+		WithExec([]string{"npm", "install", "--global", "playwright@" + PlaywrightVersion}).
+		WithMountedCache(BrowsersCacheDir, dag.CacheVolume("playwright-browsers-"+cacheKey)).
+		WithExec(append([]string{"sh", "-c", `PLAYWRIGHT_BROWSERS_PATH=` + BrowsersCacheDir + ` playwright install "$@" && mkdir --parents ` + BrowsersDir + ` && cp --archive ` + BrowsersCacheDir + `/. ` + BrowsersDir + `/`, "sh"}, nodejs.Browsers...)).
+		WithoutMount(BrowsersCacheDir)
+
+	return container, nil
+}
+
+// Install Playwright browsers required by the Playwright version of the project
+//
+// Browsers revisions depend on Playwright version, browsers already installed globally are not downloaded again, nothing is done if the project does not depend on Playwright.
+func (nodejs *Nodejs) projectBrowsersInstallation(
+	container *dagger.Container,
+) *dagger.Container {
+	if len(nodejs.Browsers) == 0 {
+		return container
+	}
+
+	return container.
+		WithExec(append([]string{"sh", "-c", `if [ -x node_modules/.bin/playwright ]; then node_modules/.bin/playwright install "$@"; fi`, "sh"}, nodejs.Browsers...))
+}
@@ -8,11 +8,13 @@
 package main
 
 import (
+	"context"
 	"dagger/nodejs/internal/dagger"
+	"fmt"
 )
 
 const (
-	// Location of npm cache
+	// Location of npm, pnpm, Yarn and Corepack caches
 	CacheDir string = "/var/cache/node"
 )
 
@@ -20,21 +22,66 @@ const (
 type Nodejs struct {
 	// +private
 	Npmrc *dagger.Secret
+	// +private
+	RedhatVersion string
+	// +private
+	Version string
+	// +private
+	OfflineCache *dagger.Directory
+	// +private
+	Registries []*NodejsRegistry
+	// +private
+	Browsers []string
 }
 
 // Node.js constructor
 func New(
-	// npm configuration file (can be used to pass registry credentials)
+	// npm configuration file (can be used to pass registry credentials, see also `with-registry`)
 	// +optional
 	npmrc *dagger.Secret,
+	// Red Hat Universal Base Image major version of Red Hat containers
+	// +optional
+	redhatVersion string,
+	// Node.js version to install from upstream tarballs (for instance `22`, `^22.11` or `lts/*`), Node.js is installed from Red Hat packages otherwise
+	// +optional
+	version string,
+	// npm cache to install dependencies from without network access (as returned by `prefetched-cache` on the same platform)
+	// +optional
+	offlineCache *dagger.Directory,
+	// Playwright browsers to install (chromium, chromium-headless-shell or firefox), with system libraries they require in Red Hat containers
+	// +optional
+	browsers []string,
 ) *Nodejs {
 	nodejs := &Nodejs{
-		Npmrc: npmrc,
+		Npmrc:         npmrc,
+		RedhatVersion: redhatVersion,
+		Version:       version,
+		OfflineCache:  offlineCache,
+		Browsers:      browsers,
 	}
 
 	return nodejs
 }
 
+// Get Red Hat Universal Base Image
+func (nodejs *Nodejs) redhat() *dagger.Redhat {
+	return dag.Redhat(dagger.RedhatOpts{Version: nodejs.RedhatVersion})
+}
+
+// Get Red Hat packages to install Node.js
+func (nodejs *Nodejs) redhatPackages() []string {
+	if nodejs.Version != "" {
+		// Node.js upstream binaries are dynamically linked to the C++ standard library
+		return append([]string{
+			"libstdc++",
+		}, nodejs.browsersRedhatPackages()...)
+	}
+
+	return append([]string{
+		"npm",
+	}, nodejs.browsersRedhatPackages()...)
+}
+
 // Configure Node.js in a container
 func (nodejs *Nodejs) Configuration(
 	// Container in which to configure Node.js
@@ -42,58 +89,93 @@ func (nodejs *Nodejs) Configuration(
 ) *dagger.Container {
 	container = container.
 		WithMountedCache(CacheDir, dag.CacheVolume("nodejs")).
-		WithEnvVariable("NPM_CONFIG_CACHE", CacheDir+"/npm")
+		WithEnvVariable("NPM_CONFIG_CACHE", CacheDir+"/npm").
+		WithEnvVariable("COREPACK_HOME", CacheDir+"/corepack").
+		WithEnvVariable("COREPACK_ENABLE_DOWNLOAD_PROMPT", "0").
+		WithEnvVariable("YARN_CACHE_FOLDER", CacheDir+"/yarn")
 
 	if nodejs.Npmrc != nil {
 		container = container.
 			WithMountedSecret("/root/.npmrc", nodejs.Npmrc)
 	}
 
+	container = nodejs.registriesConfiguration(container)
+	container = nodejs.browsersConfiguration(container)
+
+	if nodejs.OfflineCache != nil {
+		container = container.
+			WithMountedDirectory(CacheDir+"/offline", nodejs.OfflineCache).
+			WithEnvVariable("NPM_CONFIG_CACHE", CacheDir+"/offline").
+			WithEnvVariable("NPM_CONFIG_OFFLINE", "true")
+	}
+
 	return container
 }
 
-// Install Node.js in a Red Hat Universal Base Image container from packages
+// Install Node.js in a Red Hat Universal Base Image container
+//
+// Node.js is installed from upstream tarballs if a version is set, from packages otherwise.
 func (nodejs *Nodejs) RedhatInstallation(
+	ctx context.Context,
 	// Container in which to install Node.js
 	container *dagger.Container,
-) *dagger.Container {
+) (*dagger.Container, error) {
 	container = container.
-		With(dag.Redhat().Packages([]string{
-			"npm",
-		}).Installed).
-		With(nodejs.Configuration)
+		With(nodejs.redhat().Packages(nodejs.redhatPackages()).Installed)
 
-	return container
+	if nodejs.Version == "" {
+		return nodejs.browsersInstallation(ctx, container.With(nodejs.Configuration))
+	}
+
+	container, err := nodejs.Installation(ctx, container)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install Node.js: %s", err)
+	}
+
+	return container, nil
 }
 
 // Get a Red Hat Universal Base Image container with Node.js
 func (nodejs *Nodejs) RedhatContainer(
+	ctx context.Context,
 	// Platform to get container for
 	// +optional
 	platform dagger.Platform,
-) *dagger.Container {
-	return dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform}).With(nodejs.RedhatInstallation)
+) (*dagger.Container, error) {
+	return nodejs.RedhatInstallation(ctx, nodejs.redhat().Container(dagger.RedhatContainerOpts{Platform: platform}))
 }
 
-// Install Node.js in a Red Hat Minimal Universal Base Image container from packages
+// Install Node.js in a Red Hat Minimal Universal Base Image container
+//
+// Node.js is installed from upstream tarballs if a version is set, from packages otherwise.
 func (nodejs *Nodejs) RedhatMinimalInstallation(
+	ctx context.Context,
 	// Container in which to install Node.js
 	container *dagger.Container,
-) *dagger.Container {
+) (*dagger.Container, error) {
 	container = container.
-		With(dag.Redhat().Minimal().Packages([]string{
-			"npm",
-		}).Installed).
-		With(nodejs.Configuration)
+		With(nodejs.redhat().Minimal().Packages(nodejs.redhatPackages()).Installed)
 
-	return container
+	if nodejs.Version == "" {
+		return nodejs.browsersInstallation(ctx, container.With(nodejs.Configuration))
+	}
+
+	container, err := nodejs.Installation(ctx, container)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install Node.js: %s", err)
+	}
+
+	return container, nil
 }
 
 // Get a Red Hat Minimal Universal Base Image container with Node.js
 func (nodejs *Nodejs) RedhatMinimalContainer(
+	ctx context.Context,
 	// Platform to get container for
 	// +optional
 	platform dagger.Platform,
-) *dagger.Container {
-	return dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).With(nodejs.RedhatMinimalInstallation)
+) (*dagger.Container, error) {
+	return nodejs.RedhatMinimalInstallation(ctx, nodejs.redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}))
 }
@@ -0,0 +1,229 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node.js project package manager
+type packageManager struct {
+	// Name of the package manager (npm, pnpm or yarn)
+	name string
+	// Major version of the package manager, 0 if not pinned
+	major int
+}
+
+// Get the package manager of a project
+//
+// Package manager is read from `packageManager` field of `package.json` file, or detected from the lockfile otherwise.
+func projectPackageManager(
+	ctx context.Context,
+	source *dagger.Directory,
+) (*packageManager, error) {
+	contents, err := source.File("package.json").Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json file: %s", err)
+	}
+
+	var packageJson struct {
+		PackageManager string
+	}
+
+	if err := json.Unmarshal([]byte(contents), &packageJson); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json file: %s", err)
+	}
+
+	if packageJson.PackageManager != "" {
+		// Formatted as `name@version+hash`
+		name, version, _ := strings.Cut(packageJson.PackageManager, "@")
+		major, _ := strconv.Atoi(strings.Split(version, ".")[0])
+
+		return &packageManager{name: name, major: major}, nil
+	}
+
+	for _, lockfile := range []struct {
+		name           string
+		packageManager string
+	}{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+	} {
+		exists, err := source.Exists(ctx, lockfile.name)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s file: %s", lockfile.name, err)
+		}
+
+		if exists {
+			return &packageManager{name: lockfile.packageManager}, nil
+		}
+	}
+
+	return &packageManager{name: "npm"}, nil
+}
+
+// Get the command installing dependencies as locked in the lockfile
+func (packageManager *packageManager) cleanInstallCommand(
+	ctx context.Context,
+	source *dagger.Directory,
+) ([]string, error) {
+	switch packageManager.name {
+	case "npm":
+		return []string{"npm", "clean-install"}, nil
+	case "pnpm":
+		return []string{"pnpm", "install", "--frozen-lockfile", "--store-dir", CacheDir + "/pnpm"}, nil
+	case "yarn":
+		berry := packageManager.major >= 2
+
+		if packageManager.major == 0 {
+			exists, err := source.Exists(ctx, ".yarnrc.yml")
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to check .yarnrc.yml file: %s", err)
+			}
+
+			berry = exists
+		}
+
+		if berry {
+			return []string{"yarn", "install", "--immutable"}, nil
+		}
+
+		return []string{"yarn", "install", "--frozen-lockfile"}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported package manager: %q", packageManager.name)
+}
+
+// Get the package manager of a project (npm, pnpm or yarn)
+//
+// Package manager is read from `packageManager` field of `package.json` file, or detected from the lockfile otherwise.
+func (*Nodejs) PackageManager(
+	ctx context.Context,
+	// Project source directory
+	source *dagger.Directory,
+) (string, error) {
+	packageManager, err := projectPackageManager(ctx, source)
+
+	if err != nil {
+		return "", err
+	}
+
+	return packageManager.name, nil
+}
+
+// Install the package manager of a project in a Node.js container
+//
+// pnpm and Yarn are installed with Corepack, at the version pinned in `packageManager` field of `package.json` file if any.
+func (*Nodejs) PackageManagerInstallation(
+	ctx context.Context,
+	// Node.js container in which to install the package manager
+	container *dagger.Container,
+	// Project source directory
+	source *dagger.Directory,
+) (*dagger.Container, error) {
+	packageManager, err := projectPackageManager(ctx, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %s", err)
+	}
+
+	if packageManager.name == "npm" {
+		return container, nil
+	}
+
+	// Corepack is not bundled with every Node.js version
+	container = container.
+		WithExec([]string{"sh", "-c", "command -v corepack || npm install --global corepack"}).
+		WithExec([]string{"corepack", "enable", packageManager.name})
+
+	return container, nil
+}
+
+// Install dependencies of a project as locked in its lockfile
+//
+// Package manager is installed if needed, and dependencies are installed in the container working directory where the project source directory must be. Dependencies are installed without network access if an offline cache is set.
+func (nodejs *Nodejs) CleanInstallation(
+	ctx context.Context,
+	// Node.js container in which to install dependencies
+	container *dagger.Container,
+	// Project source directory
+	source *dagger.Directory,
+) (*dagger.Container, error) {
+	packageManager, err := projectPackageManager(ctx, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %s", err)
+	}
+
+	command, err := packageManager.cleanInstallCommand(ctx, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get install command: %s", err)
+	}
+
+	if nodejs.OfflineCache != nil {
+		if packageManager.name != "npm" {
+			return nil, fmt.Errorf("offline installation is only supported with npm, not %s", packageManager.name)
+		}
+
+		command = append(command, "--offline")
+	}
+
+	container, err = nodejs.PackageManagerInstallation(ctx, container, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install package manager: %s", err)
+	}
+
+	container = container.
+		WithExec(command)
+
+	return container, nil
+}
+
+// Get an npm cache containing all dependencies locked in the lockfile of a project
+//
+// Cache can be given to the constructor to install dependencies without network access. Optional dependencies specific to a platform (such as native binaries) are only prefetched for the platform the cache is built on.
+func (nodejs *Nodejs) PrefetchedCache(
+	ctx context.Context,
+	// Project source directory
+	// +defaultPath="/"
+	// +ignore=["**", "!**/package.json", "!**/.npmrc", "!package-lock.json", "!npm-shrinkwrap.json", "**/node_modules"]
+	source *dagger.Directory,
+) (*dagger.Directory, error) {
+	packageManager, err := projectPackageManager(ctx, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %s", err)
+	}
+
+	if packageManager.name != "npm" {
+		return nil, fmt.Errorf("prefetched cache is only supported with npm, not %s", packageManager.name)
+	}
+
+	container, err := nodejs.RedhatMinimalContainer(ctx, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Node.js container: %s", err)
+	}
+
+	// Dependencies are installed without running scripts only to fill the cache
+	cache := container.
+		WithEnvVariable("NPM_CONFIG_CACHE", "/tmp/npm-cache").
+		WithoutEnvVariable("NPM_CONFIG_OFFLINE").
+		WithMountedDirectory("/tmp/project", source).
+		WithWorkdir("/tmp/project").
+		WithExec([]string{"npm", "clean-install", "--ignore-scripts", "--no-audit", "--no-fund"}).
+		Directory("/tmp/npm-cache")
+
+	return cache, nil
+}
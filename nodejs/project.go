@@ -0,0 +1,166 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"fmt"
+)
+
+const (
+	// Location of Node.js project source directory
+	SourceDir string = "/src"
+)
+
+// Node.js project
+type NodejsProject struct {
+	// Get the package manager of the project (npm, pnpm or yarn)
+	PackageManager string
+	// Get a Node.js container with project source directory and installed dependencies
+	Container *dagger.Container
+}
+
+// Get a Node.js project from a source directory
+//
+// Dependencies are installed before the rest of the source directory is added, so that installation is only run again when dependencies declarations or lockfile change.
+func (nodejs *Nodejs) Project(
+	ctx context.Context,
+	// Project source directory
+	// +optional
+	// +defaultPath="/"
+	// +ignore=["node_modules"]
+	source *dagger.Directory,
+	// Node.js container to use, a Red Hat Minimal Universal Base Image container with Node.js is used otherwise
+	// +optional
+	container *dagger.Container,
+) (*NodejsProject, error) {
+	packageManager, err := projectPackageManager(ctx, source)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %s", err)
+	}
+
+	if container == nil {
+		container, err = nodejs.RedhatMinimalContainer(ctx, "")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Node.js container: %s", err)
+		}
+	}
+
+	// Files needed to install dependencies
+	dependencies := dag.Directory().
+		WithDirectory(".", source, dagger.DirectoryWithDirectoryOpts{
+			Include: []string{
+				"**/package.json",
+				".npmrc",
+				"package-lock.json",
+				"npm-shrinkwrap.json",
+				"pnpm-lock.yaml",
+				"pnpm-workspace.yaml",
+				".pnpmfile.cjs",
+				"yarn.lock",
+				".yarnrc",
+				".yarnrc.yml",
+				".yarn/releases/**",
+				".yarn/plugins/**",
+				"patches/**",
+			},
+			Exclude: []string{
+				"**/node_modules",
+			},
+		})
+
+	container = container.
+		WithDirectory(SourceDir, dependencies).
+		WithWorkdir(SourceDir)
+
+	container, err = nodejs.CleanInstallation(ctx, container, dependencies)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install dependencies: %s", err)
+	}
+
+	container = nodejs.projectBrowsersInstallation(container)
+
+	project := &NodejsProject{
+		PackageManager: packageManager.name,
+		Container: container.
+			WithDirectory(SourceDir, source, dagger.ContainerWithDirectoryOpts{
+				Exclude: []string{"**/node_modules"},
+			}),
+	}
+
+	return project, nil
+}
+
+// Set an environment variable in the Node.js project
+func (project *NodejsProject) WithEnvVariable(
+	// Environment variable name
+	name string,
+	// Environment variable value
+	value string,
+) *NodejsProject {
+	project.Container = project.Container.
+		WithEnvVariable(name, value)
+
+	return project
+}
+
+// Run a script of the Node.js project
+func (project *NodejsProject) Run(
+	// Name of the script in `package.json` file
+	script string,
+	// Arguments to pass to the script
+	// +optional
+	args ...string,
+) *NodejsProject {
+	command := []string{project.PackageManager, "run", script}
+
+	if project.PackageManager == "npm" && len(args) > 0 {
+		command = append(command, "--")
+	}
+
+	project.Container = project.Container.
+		WithExec(append(command, args...))
+
+	return project
+}
+
+// Run tests of the Node.js project
+func (project *NodejsProject) Test(
+	// Arguments to pass to the test script
+	// +optional
+	args ...string,
+) *NodejsProject {
+	return project.Run("test", args...)
+}
+
+// Get a directory of the Node.js project (for instance a build output directory)
+func (project *NodejsProject) Directory(
+	// Path of the directory, relative to the project source directory
+	path string,
+) *dagger.Directory {
+	return project.Container.Directory(path)
+}
+
+// Get combined buffered standard output and standard error stream of the last executed command in the Node.js project container
+func (project *NodejsProject) CombinedOutput(
+	ctx context.Context,
+) (string, error) {
+	return project.Container.CombinedOutput(ctx)
+}
+
+// Force evaluation of the Node.js project commands
+func (project *NodejsProject) Sync(
+	ctx context.Context,
+) (*NodejsProject, error) {
+	var err error
+
+	project.Container, err = project.Container.
+		Sync(ctx)
+
+	return project, err
+}
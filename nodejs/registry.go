@@ -0,0 +1,145 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+const (
+	// Location of npm global configuration file generated from registries configuration
+	RegistriesNpmrcPath string = "/etc/npmrc"
+)
+
+// npm registry
+type NodejsRegistry struct {
+	// +private
+	Url string
+	// +private
+	Scope string
+	// +private
+	Token *dagger.Secret
+}
+
+// Set an npm registry to get packages from and publish packages to
+//
+// Registries configuration is generated as npm global configuration file, tokens are only passed as environment variables.
+func (nodejs *Nodejs) WithRegistry(
+	// Registry URL (for instance `https://npm.pkg.github.com`)
+	url string,
+	// Scope of the packages to get from the registry (for instance `@camptocamp`), all packages are got from the registry otherwise
+	// +optional
+	scope string,
+	// Registry authentication token
+	// +optional
+	token *dagger.Secret,
+) (*Nodejs, error) {
+	if parsedUrl, err := neturl.Parse(url); err != nil || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("invalid registry URL: %q", url)
+	}
+
+	registry := &NodejsRegistry{
+		Url:   url,
+		Scope: scope,
+		Token: token,
+	}
+
+	nodejs.Registries = append(nodejs.Registries, registry)
+
+	return nodejs, nil
+}
+
+// Set npm registries configuration in a container
+func (nodejs *Nodejs) registriesConfiguration(
+	container *dagger.Container,
+) *dagger.Container {
+	if len(nodejs.Registries) == 0 {
+		return container
+	}
+
+	npmrc := ""
+
+	for i, registry := range nodejs.Registries {
+		if registry.Scope == "" {
+			npmrc += fmt.Sprintf("registry=%s\n", registry.Url)
+		} else {
+			npmrc += fmt.Sprintf("@%s:registry=%s\n", strings.TrimPrefix(registry.Scope, "@"), registry.Url)
+		}
+
+		if registry.Token != nil {
+			// npm expands environment variables in configuration files
+			tokenVariable := fmt.Sprintf("NPM_REGISTRY_TOKEN_%d", i)
+
+			// Registry URL is validated when set
+			parsedUrl, _ := neturl.Parse(registry.Url)
+
+			npmrc += fmt.Sprintf("//%s/:_authToken=${%s}\n", strings.TrimSuffix(parsedUrl.Host+parsedUrl.Path, "/"), tokenVariable)
+
+			container = container.
+				WithSecretVariable(tokenVariable, registry.Token)
+		}
+	}
+
+	container = container.
+		WithMountedFile(RegistriesNpmrcPath, dag.Directory().WithNewFile("npmrc", npmrc).File("npmrc")).
+		WithEnvVariable("NPM_CONFIG_GLOBALCONFIG", RegistriesNpmrcPath)
+
+	return container
+}
+
+// Set a secret environment variable in the Node.js project
+func (project *NodejsProject) WithSecretVariable(
+	// Environment variable name
+	name string,
+	// Environment variable secret value
+	secret *dagger.Secret,
+) *NodejsProject {
+	project.Container = project.Container.
+		WithSecretVariable(name, secret)
+
+	return project
+}
+
+// Publish the Node.js project package to its registry
+//
+// Provenance statements can only be generated in supported CI environments, whose environment variables must be set in the project (for instance `GITHUB_ACTIONS`, `ACTIONS_ID_TOKEN_REQUEST_URL` and `ACTIONS_ID_TOKEN_REQUEST_TOKEN` for GitHub Actions).
+// +cache="never"
+func (project *NodejsProject) Publish(
+	ctx context.Context,
+	// Generate and publish a provenance statement
+	// +optional
+	provenance bool,
+	// Distribution tag to publish the package with
+	// +optional
+	// +default="latest"
+	tag string,
+	// Access level of the package (public or restricted)
+	// +optional
+	access string,
+	// Do everything but publishing the package
+	// +optional
+	dryRun bool,
+) (string, error) {
+	command := []string{"npm", "publish", "--tag", tag}
+
+	if provenance {
+		command = append(command, "--provenance")
+	}
+
+	if access != "" {
+		command = append(command, "--access", access)
+	}
+
+	if dryRun {
+		command = append(command, "--dry-run")
+	}
+
+	return project.Container.
+		WithExec(command).
+		CombinedOutput(ctx)
+}
@@ -0,0 +1,493 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/nodejs/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// URL to download Node.js releases from
+	DownloadURL string = "https://nodejs.org/dist"
+
+	// URL of Node.js release keys keyring, able to verify all past releases
+	ReleaseKeysURL string = "https://github.com/nodejs/release-keys/raw/refs/heads/main/gpg/pubring.kbx"
+)
+
+// Fingerprints of primary keys of Node.js releasers, as listed in Node.js README
+//
+// Releases must be signed by one of these keys, whatever the keyring contains.
+var releaseKeysFingerprints = []string{
+	// Current releasers
+	"5BE8A3F6C8A5C01D106C0AD820B1A390B168D356", // Antoine du Hamel
+	"DD792F5973C6DE52C432CBDAC77ABFA00DDBF2B7", // Juan José Arboleda
+	"CC68F5A3106FF448322E48ED27F5E38D5B0A215F", // Marco Ippolito
+	"8FCCA13FEF1D0C2E91008E09770F7A9A5AE15600", // Michaël Zasso
+	"890C08DB8579162FEE0DF9DB8BEAB4DFCF555EF4", // Rafael Gonzaga
+	"C82FA3AE1CBEDC6BE46B9360C43CEC45C17AB93C", // Richard Lau
+	"108F52B48DB57BB0CC439B2997B01419BD92F80A", // Ruy Adorno
+	"A363A499291CBBC940DD62E41F10027AF002F8B0", // Ulises Gascón
+	// Keys used to sign previous releases
+	"C0D6248439F1D5604AAFFB4021D900FFDB233756", // Antoine du Hamel
+	"4ED778F539E3634C779C87C6D7062848A1AB005C", // Beth Griggs
+	"141F07595B7B3FFE74309A937405533BE57C7D57", // Bryan English
+	"9554F04D7259F04124DE6B476D5A82AC7E37093B", // Chris Dickinson
+	"94AE36675C464D64BAFA68DD7434390BDBE9B9C5", // Colin Ihrig
+	"1C050899334244A8AF75E53792EF661D867B9DFA", // Danielle Adams
+	"74F12602B6F1C4E913FAA37AD3A89613643B6201", // Danielle Adams
+	"B9AE9905FFD7803F25714661B63B535A4C206CA9", // Evan Lucas
+	"77984A986EBC2AA786BC0F66B01FBB92821C587A", // Gibson Fahnestock
+	"93C7E9E91B49E432C2F75674B0A78B0A6C481CF6", // Isaac Z. Schlueter
+	"56730D5401028683275BD23C23EFEFE93C4CFFFE", // Italo A. Casas
+	"71DCFD284A79C3B38668286BC97EC7A07EDE3FC1", // James M Snell
+	"FD3A5288F042B6850C66B31F09FE44734EB7990E", // Jeremiah Senkpiel
+	"61FC681DFB92A079F1685E77973F295594EC4689", // Juan José Arboleda
+	"114F43EE0176B71C7BC219DD50A3051F888C628D", // Julien Gilli
+	"C4F0DFFF4E8C1A8236409D08E73BC641CC11F4C8", // Myles Borins
+	"DD8F2338BAE7501E3DD5AC78C273792F7D83545D", // Rod Vagg
+	"A48C2BEE680E841632CD4E44F07496B3EB3C1762", // Ruben Bridgewater
+	"B9E2F5981AA6E0CD28160D9FF13993A75599653C", // Shelley Vohr
+	"7937DFD2AB06298B2293C3187D33FF9D0246406D", // Timothy J Fontaine
+}
+
+// Node.js release as listed in the release index
+type release struct {
+	Version string `json:"version"`
+	// Codename of long-term support releases, false otherwise
+	Lts any `json:"lts"`
+}
+
+// Get the latest Node.js release version matching the version specification
+//
+// Version specification can be a version, a semantic versioning range (as in `engines.node` field of `package.json` file) or an alias supported by nvm (`node`, `lts/*` or `lts/<codename>`).
+func (nodejs *Nodejs) resolvedVersion(
+	ctx context.Context,
+) (string, error) {
+	index, err := dag.HTTP(DownloadURL + "/index.json").Contents(ctx)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get release index: %s", err)
+	}
+
+	releases := []release{}
+
+	if err := json.Unmarshal([]byte(index), &releases); err != nil {
+		return "", fmt.Errorf("failed to parse release index: %s", err)
+	}
+
+	specification := strings.ToLower(strings.TrimSpace(nodejs.Version))
+
+	var matches func(release release) bool
+
+	switch {
+	case specification == "node" || specification == "latest" || specification == "current":
+		matches = func(release) bool { return true }
+	case specification == "lts" || specification == "lts/*":
+		matches = func(release release) bool {
+			_, lts := release.Lts.(string)
+
+			return lts
+		}
+	case strings.HasPrefix(specification, "lts/"):
+		matches = func(release release) bool {
+			codename, lts := release.Lts.(string)
+
+			return lts && strings.EqualFold(codename, strings.TrimPrefix(specification, "lts/"))
+		}
+	default:
+		satisfies, err := versionRange(specification)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to parse version range %q: %s", nodejs.Version, err)
+		}
+
+		matches = func(release release) bool {
+			version, err := parseVersion(release.Version)
+
+			return err == nil && version[0] >= 0 && version[1] >= 0 && version[2] >= 0 && satisfies(version)
+		}
+	}
+
+	// Releases are listed from the latest to the oldest
+	for _, release := range releases {
+		if matches(release) {
+			return strings.TrimPrefix(release.Version, "v"), nil
+		}
+	}
+
+	return "", fmt.Errorf("no release matches version %q", nodejs.Version)
+}
+
+// Parse a version, possibly partial or with wildcards
+//
+// Missing and wildcard components are set to -1.
+func parseVersion(version string) ([3]int, error) {
+	parsed := [3]int{-1, -1, -1}
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+
+	// Pre-release and build metadata are not used by Node.js releases
+	version, _, _ = strings.Cut(version, "-")
+	version, _, _ = strings.Cut(version, "+")
+
+	elements := strings.Split(version, ".")
+
+	if len(elements) > 3 {
+		return parsed, fmt.Errorf("invalid version: %q", version)
+	}
+
+	for i, element := range elements {
+		if element == "x" || element == "X" || element == "*" {
+			break
+		}
+
+		number, err := strconv.Atoi(element)
+
+		if err != nil {
+			return parsed, fmt.Errorf("invalid version: %q", version)
+		}
+
+		parsed[i] = number
+	}
+
+	return parsed, nil
+}
+
+// Compare two complete versions
+func compareVersions(a [3]int, b [3]int) int {
+	for i := range 3 {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+
+	return 0
+}
+
+// Get the lowest complete version matching a partial version
+func lowestVersion(version [3]int) [3]int {
+	for i := range 3 {
+		if version[i] < 0 {
+			version[i] = 0
+		}
+	}
+
+	return version
+}
+
+// Get the lowest complete version with a component incremented and following components reset
+func bumpedVersion(version [3]int, component int) [3]int {
+	bumped := [3]int{0, 0, 0}
+	copy(bumped[:component], version[:component])
+	bumped[component] = version[component] + 1
+
+	return bumped
+}
+
+// Get the lowest complete version greater than all versions matching a partial version
+//
+// Returns false if all versions match the partial version.
+func nextVersion(version [3]int) ([3]int, bool) {
+	for i := 2; i >= 0; i-- {
+		if version[i] >= 0 {
+			return bumpedVersion(version, i), true
+		}
+	}
+
+	return version, false
+}
+
+// Get a function checking that a version satisfies a semantic versioning range
+func versionRange(specification string) (func([3]int) bool, error) {
+	// Operators may be separated from versions by spaces
+	specification = regexp.MustCompile(`(>=|<=|>|<|=|\^|~)\s+`).ReplaceAllString(specification, "$1")
+
+	alternatives := []func([3]int) bool{}
+
+	for _, alternative := range strings.Split(specification, "||") {
+		fields := strings.Fields(alternative)
+
+		// Hyphen ranges are converted to comparators
+		if len(fields) == 3 && fields[1] == "-" {
+			fields = []string{">=" + fields[0], "<=" + fields[2]}
+		}
+
+		comparators := []func([3]int) bool{}
+
+		for _, field := range fields {
+			operator := regexp.MustCompile(`^(>=|<=|>|<|=|\^|~)?`).FindString(field)
+
+			version, err := parseVersion(strings.TrimPrefix(field, operator))
+
+			if err != nil {
+				return nil, err
+			}
+
+			lowest := lowestVersion(version)
+			next, bounded := nextVersion(version)
+
+			atLeast := func(bound [3]int) func([3]int) bool {
+				return func(v [3]int) bool { return compareVersions(v, bound) >= 0 }
+			}
+
+			below := func(bound [3]int, bounded bool) func([3]int) bool {
+				return func(v [3]int) bool { return !bounded || compareVersions(v, bound) < 0 }
+			}
+
+			switch operator {
+			case ">=":
+				comparators = append(comparators, atLeast(lowest))
+			case ">":
+				if bounded {
+					comparators = append(comparators, atLeast(next))
+				} else {
+					comparators = append(comparators, func([3]int) bool { return false })
+				}
+			case "<":
+				comparators = append(comparators, below(lowest, true))
+			case "<=":
+				comparators = append(comparators, below(next, bounded))
+			case "^":
+				// Versions with the same leftmost non-zero component
+				i := 0
+
+				for i < 2 && version[i] == 0 && version[i+1] >= 0 {
+					i++
+				}
+
+				comparators = append(comparators, atLeast(lowest), below(bumpedVersion(version, i), version[0] >= 0))
+			case "~":
+				// Versions with the same minor version, or the same major version if minor version is not given
+				i := 0
+
+				if version[1] >= 0 {
+					i = 1
+				}
+
+				comparators = append(comparators, atLeast(lowest), below(bumpedVersion(version, i), version[0] >= 0))
+			default:
+				comparators = append(comparators, atLeast(lowest), below(next, bounded))
+			}
+		}
+
+		alternatives = append(alternatives, func(v [3]int) bool {
+			for _, comparator := range comparators {
+				if !comparator(v) {
+					return false
+				}
+			}
+
+			return true
+		})
+	}
+
+	satisfies := func(v [3]int) bool {
+		for _, alternative := range alternatives {
+			if alternative(v) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return satisfies, nil
+}
+
+// Get a root filesystem overlay with Node.js
+//
+// Node.js release checksums are verified with the Node.js release keys.
+func (nodejs *Nodejs) Overlay(
+	ctx context.Context,
+	// Platform to get Node.js for
+	// +optional
+	platform dagger.Platform,
+	// Filesystem prefix under which to install Node.js
+	// +optional
+	prefix string,
+) (*dagger.Directory, error) {
+	if nodejs.Version == "" {
+		return nil, errors.New("Node.js version must be set to get Node.js from upstream tarballs")
+	}
+
+	if prefix == "" {
+		prefix = "/usr/local"
+	}
+
+	if platform == "" {
+		defaultPlatform, err := dag.DefaultPlatform(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get platform: %s", err)
+		}
+
+		platform = defaultPlatform
+	}
+
+	version, err := nodejs.resolvedVersion(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Node.js version: %s", err)
+	}
+
+	platformElements := strings.Split(string(platform), "/")
+
+	os := platformElements[0]
+	arch := platformElements[1]
+
+	switch arch {
+	case "amd64":
+		arch = "x64"
+	case "arm":
+		arch = "armv7l"
+	}
+
+	downloadURL := DownloadURL + "/v" + version
+
+	archiveName := fmt.Sprintf("node-v%s-%s-%s.tar.gz", version, os, arch)
+	checksumsName := "SHASUMS256.txt"
+	checksumsSignatureName := checksumsName + ".sig"
+
+	archive := dag.HTTP(downloadURL + "/" + archiveName)
+	checksums := dag.HTTP(downloadURL + "/" + checksumsName)
+	checksumsSignature := dag.HTTP(downloadURL + "/" + checksumsSignatureName)
+
+	const (
+		releaseKeysName             = "release-keys.kbx"
+		releaseKeysFingerprintsName = "release-keys-fingerprints.txt"
+	)
+
+	container := nodejs.redhat().Container().
+		With(nodejs.redhat().Packages([]string{
+			"gnupg2",
+		}).Installed).
+		WithMountedFile(releaseKeysName, dag.HTTP(ReleaseKeysURL)).
+		WithNewFile(releaseKeysFingerprintsName, strings.Join(releaseKeysFingerprints, "\n")+"\n").
+		WithMountedFile(archiveName, archive).
+		WithMountedFile(checksumsName, checksums).
+		WithMountedFile(checksumsSignatureName, checksumsSignature).
+		// Signature primary key fingerprint is the last field of VALIDSIG status line
+		WithExec([]string{"sh", "-c", "gpgv --status-fd 1 --keyring ./" + releaseKeysName + " " + checksumsSignatureName + " " + checksumsName + " > gpgv.status && awk '$2 == \"VALIDSIG\" { print $NF }' gpgv.status | grep --fixed-strings --line-regexp --file " + releaseKeysFingerprintsName}).
+		WithExec([]string{"sh", "-c", "grep -w " + archiveName + " " + checksumsName + " | sha256sum -c"}).
+		WithExec([]string{"mkdir", "/tmp/overlay"}).
+		WithExec([]string{"tar", "--extract", "--file", archiveName, "--directory", "/tmp/overlay", "--strip-components", "1", "--exclude", "*.md", "--exclude", "LICENSE"})
+
+	overlay := dag.Directory().
+		WithDirectory(prefix, container.Directory("/tmp/overlay"))
+
+	return overlay, nil
+}
+
+// Install Node.js in a container from upstream tarballs
+func (nodejs *Nodejs) Installation(
+	ctx context.Context,
+	// Container in which to install Node.js
+	container *dagger.Container,
+) (*dagger.Container, error) {
+	platform, err := container.Platform(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container platform: %s", err)
+	}
+
+	overlay, err := nodejs.Overlay(ctx, platform, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Node.js overlay: %s", err)
+	}
+
+	container = container.
+		WithDirectory("/", overlay).
+		With(nodejs.Configuration)
+
+	return nodejs.browsersInstallation(ctx, container)
+}
+
+// Get Node.js with the version required by a project
+//
+// Version is read from `.nvmrc` file, `.node-version` file or `engines.node` field of `package.json` file, in this order. Version is left unchanged if none is found.
+func (nodejs *Nodejs) WithProjectVersion(
+	ctx context.Context,
+	// Project source directory
+	source *dagger.Directory,
+) (*Nodejs, error) {
+	version := ""
+
+	for _, name := range []string{".nvmrc", ".node-version"} {
+		exists, err := source.Exists(ctx, name)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s file: %s", name, err)
+		}
+
+		if !exists {
+			continue
+		}
+
+		contents, err := source.File(name).Contents(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s file: %s", name, err)
+		}
+
+		// Comments are allowed in nvm configuration
+		for _, line := range strings.Split(contents, "\n") {
+			line, _, _ = strings.Cut(line, "#")
+
+			if line = strings.TrimSpace(line); line != "" {
+				version = line
+
+				break
+			}
+		}
+
+		if version != "" {
+			break
+		}
+	}
+
+	if version == "" {
+		exists, err := source.Exists(ctx, "package.json")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check package.json file: %s", err)
+		}
+
+		if exists {
+			contents, err := source.File("package.json").Contents(ctx)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read package.json file: %s", err)
+			}
+
+			var packageJson struct {
+				Engines struct {
+					Node string
+				}
+			}
+
+			if err := json.Unmarshal([]byte(contents), &packageJson); err != nil {
+				return nil, fmt.Errorf("failed to parse package.json file: %s", err)
+			}
+
+			version = packageJson.Engines.Node
+		}
+	}
+
+	if version == "" {
+		return nodejs, nil
+	}
+
+	project := *nodejs
+	project.Version = version
+
+	return &project, nil
+}
@@ -35,6 +35,9 @@ func (*Presentation) Builder(
 	directory *dagger.Directory,
 	// npm configuration file (used to pass GitHub registry credentials)
 	npmrc *dagger.Secret,
+	// npm cache to install dependencies from without network access (as returned by Node.js module `prefetched-cache` function)
+	// +optional
+	npmCache *dagger.Directory,
 ) (*PresentationBuilder, error) {
 	const packageJsonFilename string = "package.json"
 
@@ -52,18 +55,30 @@ func (*Presentation) Builder(
 		return nil, fmt.Errorf("failed to unmarshal %q file: %w", packageJsonFilename, err)
 	}
 
+	nodejs := dag.Nodejs(dagger.NodejsOpts{
+		Npmrc:        npmrc,
+		OfflineCache: npmCache,
+	}).WithProjectVersion(directory)
+
 	builder := &PresentationBuilder{}
 
 	kroki := dag.Kroki()
 
-	builder.Container = dag.Redhat().Minimal().Container().
-		With(dag.Nodejs(dagger.NodejsOpts{
-			Npmrc: npmrc,
-		}).RedhatMinimalInstallation).
-		WithServiceBinding("kroki", kroki.Server()).
-		WithMountedDirectory(".", directory).
-		WithExec([]string{"npm", "clean-install"}).
-		WithEntrypoint([]string{"npm", "run", "all"}).
+	project := nodejs.Project(dagger.NodejsProjectOpts{
+		Source: directory,
+		Container: dag.Redhat().Minimal().Container().
+			With(nodejs.RedhatMinimalInstallation).
+			WithServiceBinding("kroki", kroki.Server()),
+	})
+
+	packageManager, err := project.PackageManager(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package manager: %w", err)
+	}
+
+	builder.Container = project.Container().
+		WithEntrypoint([]string{packageManager, "run", "all"}).
 		WithoutDefaultArgs()
 
 	return builder, nil
@@ -101,3 +116,17 @@ func (build *PresentationBuildResult) Container(
 func (build *PresentationBuildResult) Server() *dagger.Service {
 	return dag.Caddy(build.Directory).Server()
 }
+
+// Get the presentation exported to PDF
+//
+// Presentation is served and printed with headless Chromium provisioned by Node.js module.
+func (build *PresentationBuildResult) Pdf() *dagger.File {
+	const scriptName = "pdf.js"
+
+	return dag.Nodejs(dagger.NodejsOpts{Browsers: []string{"chromium"}}).
+		RedhatMinimalContainer().
+		WithMountedFile("/tmp/"+scriptName, dag.CurrentModule().Source().File(scriptName)).
+		WithServiceBinding("presentation", build.Server()).
+		WithExec([]string{"sh", "-c", `NODE_PATH="$(npm root --global)" node /tmp/` + scriptName + ` http://presentation:8080/ /tmp/presentation.pdf`}).
+		File("/tmp/presentation.pdf")
+}
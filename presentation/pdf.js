@@ -0,0 +1,36 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Export a reveal.js presentation to PDF with headless Chromium
+//
+// Usage: node pdf.js <presentation URL> <PDF file>
+
+'use strict';
+
+const { chromium } = require('playwright');
+
+async function main() {
+  const [url, output] = process.argv.slice(2);
+
+  const browser = await chromium.launch();
+
+  try {
+    const page = await browser.newPage();
+
+    // reveal.js lays out slides for printing when `print-pdf` query parameter is set
+    const printUrl = new URL(url);
+    printUrl.searchParams.set('print-pdf', '');
+
+    await page.goto(printUrl.toString(), { waitUntil: 'networkidle' });
+    await page.waitForSelector('.reveal.ready');
+
+    await page.pdf({ path: output, preferCSSPageSize: true, printBackground: true });
+  } finally {
+    await browser.close();
+  }
+}
+
+main().catch((error) => {
+  console.error(error.message);
+  process.exit(1);
+});
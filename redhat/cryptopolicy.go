@@ -0,0 +1,99 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/redhat/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Location of system-wide cryptographic policies configuration
+	CryptoPoliciesDir string = "/etc/crypto-policies"
+)
+
+// Red Hat Universal Base Image system-wide cryptographic policy
+type RedhatCryptoPolicy struct {
+	// +private
+	Version string
+	// +private
+	Policy string
+	// +private
+	Policies *dagger.Directory
+}
+
+// Red Hat Universal Base Image system-wide cryptographic policy constructor
+func (redhat *Redhat) CryptoPolicy(
+	// Policy to set, optionally with subpolicies (for instance `FIPS`, `DEFAULT:SHA1` or `FIPS:OSPP`)
+	// +optional
+	// +default="FIPS"
+	policy string,
+	// Directory containing custom policies (`.pol` files) and custom subpolicies (`.pmod` files in `modules` directory), as in `/etc/crypto-policies/policies` directory
+	// +optional
+	policies *dagger.Directory,
+) *RedhatCryptoPolicy {
+	cryptoPolicy := &RedhatCryptoPolicy{
+		Version:  redhat.Version,
+		Policy:   policy,
+		Policies: policies,
+	}
+
+	return cryptoPolicy
+}
+
+// Set the system-wide cryptographic policy in a Red Hat Universal Base Image container
+//
+// Policy is generated in a builder container, so that it can be set in containers lacking policy tools like minimal and micro containers.
+//
+// In FIPS policies, OpenSSL is also forced in FIPS mode as the kernel FIPS mode of the host cannot be enabled from a container.
+func (cryptoPolicy *RedhatCryptoPolicy) Configured(
+	ctx context.Context,
+	// Container in which to set the policy
+	container *dagger.Container,
+) (*dagger.Container, error) {
+	redhat := &Redhat{
+		Version: cryptoPolicy.Version,
+	}
+
+	builder, err := redhat.Packages([]string{"crypto-policies-scripts"}, false, nil).Installed(ctx, redhat.Container(""))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install cryptographic policy tools: %w", err)
+	}
+
+	if cryptoPolicy.Policies != nil {
+		builder = builder.
+			WithDirectory(CryptoPoliciesDir+"/policies", cryptoPolicy.Policies)
+	}
+
+	builder = builder.
+		WithExec([]string{"update-crypto-policies", "--no-reload", "--set", cryptoPolicy.Policy})
+
+	container = container.
+		WithDirectory(CryptoPoliciesDir, builder.Directory(CryptoPoliciesDir))
+
+	if strings.HasPrefix(cryptoPolicy.Policy, "FIPS") {
+		container = container.
+			WithEnvVariable("OPENSSL_FORCE_FIPS_MODE", "1")
+	}
+
+	return container, nil
+}
+
+// Get the system-wide cryptographic policy effective in a Red Hat Universal Base Image container
+func (*Redhat) EffectiveCryptoPolicy(
+	ctx context.Context,
+	// Container to get the policy of
+	container *dagger.Container,
+) (string, error) {
+	policy, err := container.File(CryptoPoliciesDir + "/state/current").Contents(ctx)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read current policy: %w", err)
+	}
+
+	return strings.TrimSpace(policy), nil
+}
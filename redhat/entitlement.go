@@ -0,0 +1,191 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"dagger/redhat/internal/dagger"
+	"fmt"
+	"time"
+)
+
+const (
+	// Location of mounted entitlement material
+	EntitlementDir string = "/run/secrets/redhat-entitlement"
+
+	// Location of mounted Red Hat Enterprise Linux repositories configuration
+	EntitlementRepositoriesPath string = "/etc/yum.repos.d/redhat-entitlement.repo"
+)
+
+// Red Hat Enterprise Linux repositories configuration template
+//
+// Template arguments are the major version and the entitlement material directory.
+const entitlementRepositoriesTemplate string = `[rhel-%[1]s-baseos]
+name = Red Hat Enterprise Linux %[1]s BaseOS
+baseurl = https://cdn.redhat.com/content/dist/rhel%[1]s/%[1]s/$basearch/baseos/os
+enabled = 1
+gpgcheck = 1
+gpgkey = file:///etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release
+sslverify = 1
+sslcacert = %[2]s/ca.pem
+sslclientcert = %[2]s/certificate.pem
+sslclientkey = %[2]s/key.pem
+
+[rhel-%[1]s-appstream]
+name = Red Hat Enterprise Linux %[1]s AppStream
+baseurl = https://cdn.redhat.com/content/dist/rhel%[1]s/%[1]s/$basearch/appstream/os
+enabled = 1
+gpgcheck = 1
+gpgkey = file:///etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release
+sslverify = 1
+sslcacert = %[2]s/ca.pem
+sslclientcert = %[2]s/certificate.pem
+sslclientkey = %[2]s/key.pem
+`
+
+// Red Hat subscription entitlement
+type RedhatEntitlement struct {
+	// +private
+	Certificate *dagger.Secret
+	// +private
+	Key *dagger.Secret
+	// +private
+	Organization string
+	// +private
+	ActivationKey *dagger.Secret
+}
+
+// Red Hat subscription entitlement constructor
+//
+// Either an entitlement certificate and its key (as found in `/etc/pki/entitlement` directory of a subscribed system), or an organization ID and an activation key must be given.
+//
+// When an activation key is given, a system is registered for each installation and unregistered once packages are installed.
+func (*Redhat) Entitlement(
+	// Entitlement certificate
+	// +optional
+	certificate *dagger.Secret,
+	// Entitlement certificate key
+	// +optional
+	key *dagger.Secret,
+	// Organization ID to register with
+	// +optional
+	organization string,
+	// Activation key to register with
+	// +optional
+	activationKey *dagger.Secret,
+) (*RedhatEntitlement, error) {
+	certificateGiven := certificate != nil || key != nil
+	activationKeyGiven := organization != "" || activationKey != nil
+
+	if certificateGiven == activationKeyGiven {
+		return nil, fmt.Errorf("either an entitlement certificate and its key, or an organization ID and an activation key must be given")
+	}
+
+	if certificateGiven && (certificate == nil || key == nil) {
+		return nil, fmt.Errorf("both entitlement certificate and its key must be given")
+	}
+
+	if activationKeyGiven && (organization == "" || activationKey == nil) {
+		return nil, fmt.Errorf("both organization ID and activation key must be given")
+	}
+
+	entitlement := &RedhatEntitlement{
+		Certificate:   certificate,
+		Key:           key,
+		Organization:  organization,
+		ActivationKey: activationKey,
+	}
+
+	return entitlement, nil
+}
+
+// Mount entitlement material and Red Hat Enterprise Linux repositories configuration in a container
+//
+// Returns the container along with the mount paths to unmount once packages are installed, and with a function to call once packages are installed when a system was registered with an activation key.
+//
+// A system registered with an activation key must be unregistered once packages are installed, as its entitlement certificates are revoked along with it.
+func (entitlement *RedhatEntitlement) mounted(
+	ctx context.Context,
+	container *dagger.Container,
+	version string,
+) (*dagger.Container, []string, func(context.Context) error, error) {
+	builder := (&Redhat{Version: version}).Container("")
+
+	repositories := dag.Directory().
+		WithNewFile("redhat-entitlement.repo", fmt.Sprintf(entitlementRepositoriesTemplate, version, EntitlementDir)).
+		File("redhat-entitlement.repo")
+
+	certificate := entitlement.Certificate
+	key := entitlement.Key
+
+	var unregister func(context.Context) error
+
+	if entitlement.ActivationKey != nil {
+		// Registration is run on every evaluation, so that the system is never reused once unregistered
+		registered, err := builder.
+			WithMountedTemp("/etc/pki/consumer").
+			WithMountedTemp("/etc/pki/entitlement").
+			WithMountedTemp("/var/lib/rhsm").
+			WithEnvVariable("SMDEV_CONTAINER_OFF", "1").
+			WithEnvVariable("CACHE_BUSTER", time.Now().String()).
+			WithEnvVariable("ORGANIZATION", entitlement.Organization).
+			WithSecretVariable("ACTIVATION_KEY", entitlement.ActivationKey).
+			WithExec([]string{"sh", "-c", `subscription-manager register --org "$ORGANIZATION" --activationkey "$ACTIVATION_KEY" && mkdir /tmp/entitlement && cp /etc/pki/entitlement/*-key.pem /tmp/entitlement/key.pem && cp $(ls /etc/pki/entitlement/*.pem | grep -v -- -key.pem) /tmp/entitlement/certificate.pem && cp /etc/pki/consumer/cert.pem /tmp/entitlement/consumer-certificate.pem && cp /etc/pki/consumer/key.pem /tmp/entitlement/consumer-key.pem`}).
+			Sync(ctx)
+
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to register system: %w", err)
+		}
+
+		// Entitlement material is only passed as secrets, material left in the registration layer is revoked once the system is unregistered
+		material := map[string]*dagger.Secret{}
+
+		for _, name := range []string{"certificate", "key", "consumer-certificate", "consumer-key"} {
+			contents, err := registered.File("/tmp/entitlement/" + name + ".pem").Contents(ctx)
+
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read registered system %s: %w", name, err)
+			}
+
+			// Secret name is specific to the registration, so that registrations in a same session do not share secrets
+			material[name] = dag.SetSecret(fmt.Sprintf("redhat-entitlement-%s-%x", name, sha256.Sum256([]byte(contents))), contents)
+		}
+
+		certificate = material["certificate"]
+		key = material["key"]
+
+		unregister = func(ctx context.Context) error {
+			_, err := builder.
+				WithMountedSecret("/etc/pki/consumer/cert.pem", material["consumer-certificate"]).
+				WithMountedSecret("/etc/pki/consumer/key.pem", material["consumer-key"]).
+				WithMountedTemp("/var/lib/rhsm").
+				WithEnvVariable("SMDEV_CONTAINER_OFF", "1").
+				WithEnvVariable("CACHE_BUSTER", time.Now().String()).
+				WithExec([]string{"subscription-manager", "unregister"}).
+				Sync(ctx)
+
+			if err != nil {
+				return fmt.Errorf("failed to unregister system: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	container = container.
+		WithMountedFile(EntitlementDir+"/ca.pem", builder.File("/etc/rhsm/ca/redhat-uep.pem")).
+		WithMountedFile(EntitlementRepositoriesPath, repositories).
+		WithMountedSecret(EntitlementDir+"/certificate.pem", certificate).
+		WithMountedSecret(EntitlementDir+"/key.pem", key)
+
+	mounts := []string{
+		EntitlementDir + "/ca.pem",
+		EntitlementDir + "/certificate.pem",
+		EntitlementDir + "/key.pem",
+		EntitlementRepositoriesPath,
+	}
+
+	return container, mounts, unregister, nil
+}
@@ -0,0 +1,135 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"dagger/redhat/internal/dagger"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Script hardening a root filesystem mounted under `$ROOTFS`
+const hardeningScript string = `
+set -eu
+
+if ! grep -q "^$NAME:" "$ROOTFS/etc/group"; then
+	groupadd --root "$ROOTFS" --gid "$ID" "$NAME"
+fi
+
+if ! grep -q "^$NAME:" "$ROOTFS/etc/passwd"; then
+	useradd --root "$ROOTFS" --uid "$ID" --gid "$ID" --create-home --shell /sbin/nologin "$NAME"
+fi
+
+for path in "$@"; do
+	mkdir -p "$ROOTFS/$path"
+	chown -R "$ID:$ID" "$ROOTFS/$path"
+done
+
+find "$ROOTFS" -type f -perm /6000 -exec chmod ug-s {} +
+
+if [ "$DROP_PACKAGE_MANAGERS" = "true" ]; then
+	for package in microdnf dnf yum; do
+		if rpm --root "$ROOTFS" --query --quiet "$package"; then
+			rpm --root "$ROOTFS" --erase --nodeps --noscripts "$package"
+		fi
+	done
+fi
+`
+
+// Red Hat Universal Base Image container hardening
+type RedhatHardening struct {
+	// +private
+	Version string
+	// +private
+	Name string
+	// +private
+	Id int
+	// +private
+	Paths []string
+	// +private
+	KeepPackageManagers bool
+	// +private
+	Labels []string
+}
+
+// Red Hat Universal Base Image container hardening constructor
+func (redhat *Redhat) Hardening(
+	// Name of the non-root user and group to run the container as
+	// +optional
+	// +default="app"
+	name string,
+	// ID of the non-root user and group to run the container as
+	// +optional
+	// +default=65535
+	id int,
+	// Directories to create if needed and give ownership of to the non-root user
+	// +optional
+	paths []string,
+	// Keep package managers (microdnf, dnf and yum) in the container
+	// +optional
+	keepPackageManagers bool,
+	// OCI labels to set on the container (formatted as `name=value`)
+	// +optional
+	labels []string,
+) (*RedhatHardening, error) {
+	if id <= 0 {
+		return nil, fmt.Errorf("user and group ID must be a non-root ID: %d", id)
+	}
+
+	for _, label := range labels {
+		if !strings.Contains(label, "=") {
+			return nil, fmt.Errorf("label is not formatted as name=value: %q", label)
+		}
+	}
+
+	hardening := &RedhatHardening{
+		Version:             redhat.Version,
+		Name:                name,
+		Id:                  id,
+		Paths:               paths,
+		KeepPackageManagers: keepPackageManagers,
+		Labels:              labels,
+	}
+
+	return hardening, nil
+}
+
+// Harden a Red Hat Universal Base Image container
+//
+// A non-root user and group are created and the container is set to run as this user, given directories are owned by this user, setuid and setgid bits are removed from files, package managers are removed and OCI labels are set.
+//
+// Root filesystem of the container is modified in a builder container so that no tool is needed in the container itself.
+func (hardening *RedhatHardening) Hardened(
+	// Container to harden
+	container *dagger.Container,
+) *dagger.Container {
+	const rootfs string = "/tmp/rootfs"
+
+	redhat := &Redhat{
+		Version: hardening.Version,
+	}
+
+	hardenedRootfs := redhat.Container("").
+		WithMountedDirectory(rootfs, container.Rootfs()).
+		WithEnvVariable("ROOTFS", rootfs).
+		WithEnvVariable("NAME", hardening.Name).
+		WithEnvVariable("ID", strconv.Itoa(hardening.Id)).
+		WithEnvVariable("DROP_PACKAGE_MANAGERS", strconv.FormatBool(!hardening.KeepPackageManagers)).
+		WithExec(append([]string{"sh", "-c", hardeningScript, "sh"}, hardening.Paths...)).
+		Directory(rootfs)
+
+	container = container.
+		WithRootfs(hardenedRootfs).
+		WithUser(strconv.Itoa(hardening.Id))
+
+	for _, label := range hardening.Labels {
+		name, value, _ := strings.Cut(label, "=")
+
+		container = container.
+			WithLabel(name, value)
+	}
+
+	return container
+}
@@ -8,7 +8,9 @@
 package main
 
 import (
+	"context"
 	"dagger/redhat/internal/dagger"
+	"fmt"
 	"strings"
 )
 
@@ -16,73 +18,292 @@ const (
 	// Red Hat Universal Base Image container registry
 	ImageRegistry string = "registry.access.redhat.com"
 
-	// Red Hat Universal Base Image container repository
-	ImageRepository string = "ubi10"
-	// Red Hat Universal Base Image container tag
-	ImageTag string = "10.1-1770180700"
-	// Red Hat Universal Base Image container digest
-	ImageDigest string = "sha256:b9e5730d0b6dba45e82c15fb8f49c6082e01cdcb5e4f6ba96535dab42a4d2cf0"
-
-	// Red Hat Minimal Universal Base Image container repository
-	MinimalImageRepository string = "ubi10-minimal"
-	// Red Hat Minimal Universal Base Image container tag
-	MinimalImageTag string = "10.1-1770180557"
-	// Red Hat Minimal Universal Base Image container digest
-	MinimalImageDigest string = "sha256:a74a7a92d3069bfac09c6882087771fc7db59fa9d8e16f14f4e012fe7288554c"
-
-	// Red Hat Micro Universal Base Image container repository
-	MicroImageRepository string = "ubi10-micro"
-	// Red Hat Micro Universal Base Image container tag
-	MicroImageTag string = "10.1-1769518576"
-	// Red Hat Micro Universal Base Image container digest
-	MicroImageDigest string = "sha256:551f8ee81be3dbabd45a9c197f3724b9724c1edb05d68d10bfe85a5c9e46a458"
+	// Default Red Hat Universal Base Image major version
+	DefaultVersion string = "10"
+
+	// Red Hat Universal Base Image 8 container repository
+	Ubi8ImageRepository string = "ubi8"
+	// Red Hat Universal Base Image 8 container tag
+	Ubi8ImageTag string = "8.10"
+	// Red Hat Universal Base Image 8 container digest (set by `update` function, version is unsupported until set)
+	Ubi8ImageDigest string = ""
+
+	// Red Hat Minimal Universal Base Image 8 container repository
+	Ubi8MinimalImageRepository string = "ubi8-minimal"
+	// Red Hat Minimal Universal Base Image 8 container tag
+	Ubi8MinimalImageTag string = "8.10"
+	// Red Hat Minimal Universal Base Image 8 container digest (set by `update` function, version is unsupported until set)
+	Ubi8MinimalImageDigest string = ""
+
+	// Red Hat Micro Universal Base Image 8 container repository
+	Ubi8MicroImageRepository string = "ubi8-micro"
+	// Red Hat Micro Universal Base Image 8 container tag
+	Ubi8MicroImageTag string = "8.10"
+	// Red Hat Micro Universal Base Image 8 container digest (set by `update` function, version is unsupported until set)
+	Ubi8MicroImageDigest string = ""
+
+	// Red Hat Universal Base Image 9 container repository
+	Ubi9ImageRepository string = "ubi9"
+	// Red Hat Universal Base Image 9 container tag
+	Ubi9ImageTag string = "9.6"
+	// Red Hat Universal Base Image 9 container digest (set by `update` function, version is unsupported until set)
+	Ubi9ImageDigest string = ""
+
+	// Red Hat Minimal Universal Base Image 9 container repository
+	Ubi9MinimalImageRepository string = "ubi9-minimal"
+	// Red Hat Minimal Universal Base Image 9 container tag
+	Ubi9MinimalImageTag string = "9.6"
+	// Red Hat Minimal Universal Base Image 9 container digest (set by `update` function, version is unsupported until set)
+	Ubi9MinimalImageDigest string = ""
+
+	// Red Hat Micro Universal Base Image 9 container repository
+	Ubi9MicroImageRepository string = "ubi9-micro"
+	// Red Hat Micro Universal Base Image 9 container tag
+	Ubi9MicroImageTag string = "9.6"
+	// Red Hat Micro Universal Base Image 9 container digest (set by `update` function, version is unsupported until set)
+	Ubi9MicroImageDigest string = ""
+
+	// Red Hat Universal Base Image 10 container repository
+	Ubi10ImageRepository string = "ubi10"
+	// Red Hat Universal Base Image 10 container tag
+	Ubi10ImageTag string = "10.1-1770180700"
+	// Red Hat Universal Base Image 10 container digest
+	Ubi10ImageDigest string = "sha256:b9e5730d0b6dba45e82c15fb8f49c6082e01cdcb5e4f6ba96535dab42a4d2cf0"
+
+	// Red Hat Minimal Universal Base Image 10 container repository
+	Ubi10MinimalImageRepository string = "ubi10-minimal"
+	// Red Hat Minimal Universal Base Image 10 container tag
+	Ubi10MinimalImageTag string = "10.1-1770180557"
+	// Red Hat Minimal Universal Base Image 10 container digest
+	Ubi10MinimalImageDigest string = "sha256:a74a7a92d3069bfac09c6882087771fc7db59fa9d8e16f14f4e012fe7288554c"
+
+	// Red Hat Micro Universal Base Image 10 container repository
+	Ubi10MicroImageRepository string = "ubi10-micro"
+	// Red Hat Micro Universal Base Image 10 container tag
+	Ubi10MicroImageTag string = "10.1-1769518576"
+	// Red Hat Micro Universal Base Image 10 container digest
+	Ubi10MicroImageDigest string = "sha256:551f8ee81be3dbabd45a9c197f3724b9724c1edb05d68d10bfe85a5c9e46a458"
+
+	// Location of extracted CA certificates trust
+	CaTrustExtractedDir string = "/etc/pki/ca-trust/extracted"
+
+	// Location of DNF cache
+	DnfCacheDir string = "/var/cache/dnf"
+	// Location of microdnf cache
+	MicrodnfCacheDir string = "/var/cache/yum"
 )
 
+// Container image
+type image struct {
+	repository string
+	tag        string
+	digest     string
+}
+
+// Get the reference of a container image
+func (image image) reference() string {
+	reference := ImageRegistry + "/" + image.repository + ":" + image.tag
+
+	if image.digest != "" {
+		reference += "@" + image.digest
+	}
+
+	return reference
+}
+
+// Red Hat Universal Base Images of each major version
+var images = map[string]struct {
+	standard image
+	minimal  image
+	micro    image
+}{
+	"8": {
+		standard: image{Ubi8ImageRepository, Ubi8ImageTag, Ubi8ImageDigest},
+		minimal:  image{Ubi8MinimalImageRepository, Ubi8MinimalImageTag, Ubi8MinimalImageDigest},
+		micro:    image{Ubi8MicroImageRepository, Ubi8MicroImageTag, Ubi8MicroImageDigest},
+	},
+	"9": {
+		standard: image{Ubi9ImageRepository, Ubi9ImageTag, Ubi9ImageDigest},
+		minimal:  image{Ubi9MinimalImageRepository, Ubi9MinimalImageTag, Ubi9MinimalImageDigest},
+		micro:    image{Ubi9MicroImageRepository, Ubi9MicroImageTag, Ubi9MicroImageDigest},
+	},
+	"10": {
+		standard: image{Ubi10ImageRepository, Ubi10ImageTag, Ubi10ImageDigest},
+		minimal:  image{Ubi10MinimalImageRepository, Ubi10MinimalImageTag, Ubi10MinimalImageDigest},
+		micro:    image{Ubi10MicroImageRepository, Ubi10MicroImageTag, Ubi10MicroImageDigest},
+	},
+}
+
 // Red Hat Universal Base Image
-type Redhat struct{}
+type Redhat struct {
+	// +private
+	Version string
+	// +private
+	AdditionalCaCertificates []*dagger.File
+}
 
 // Red Hat Universal Base Image constructor
-func New() *Redhat {
-	return &Redhat{}
+func New(
+	// Red Hat Universal Base Image major version (8, 9 or 10)
+	// +optional
+	// +default="10"
+	version string,
+	// Additional CA certificates in PEM format to trust along with Red Hat Universal Base Image CA certificates
+	// +optional
+	caCertificates []*dagger.File,
+) (*Redhat, error) {
+	versionImages, ok := images[version]
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported Red Hat Universal Base Image version: %q", version)
+	}
+
+	// Images are pinned by digest, a version whose images are not pinned yet is not supported
+	for _, image := range []image{versionImages.standard, versionImages.minimal, versionImages.micro} {
+		if image.digest == "" {
+			return nil, fmt.Errorf("unsupported Red Hat Universal Base Image version: %q (%s image is not pinned by digest)", version, image.repository)
+		}
+	}
+
+	redhat := &Redhat{
+		Version:                  version,
+		AdditionalCaCertificates: caCertificates,
+	}
+
+	return redhat, nil
 }
 
 // Get a Red Hat Universal Base Image container
-func (*Redhat) Container(
+//
+// Additional CA certificates given to the constructor are trusted in the container.
+func (redhat *Redhat) Container(
 	// Platform to get container for
 	// +optional
 	platform dagger.Platform,
 ) *dagger.Container {
 	container := dag.Container(dagger.ContainerOpts{Platform: platform}).
-		From(ImageRegistry + "/" + ImageRepository + ":" + ImageTag + "@" + ImageDigest).
+		From(images[redhat.Version].standard.reference()).
 		WithWorkdir("/home")
 
-	return container
+	return redhat.additionalCaCertificates(container)
 }
 
 // Red Hat Universal Base Image packages
 type RedhatPackages struct {
+	// +private
+	Version string
 	// +private
 	Names []string
+	// +private
+	Cache bool
+	// +private
+	Entitlement *RedhatEntitlement
 }
 
 // Red Hat Universal Base Image packages constructor
-func (*Redhat) Packages(
+func (redhat *Redhat) Packages(
 	// Packages name
 	names []string,
+	// Reuse downloaded repository metadata and packages between installations
+	// +optional
+	cache bool,
+	// Red Hat subscription entitlement giving access to Red Hat Enterprise Linux repositories
+	// +optional
+	entitlement *RedhatEntitlement,
 ) *RedhatPackages {
 	packages := &RedhatPackages{
-		Names: names,
+		Version:     redhat.Version,
+		Names:       names,
+		Cache:       cache,
+		Entitlement: entitlement,
 	}
 
 	return packages
 }
 
 // Install packages in a Red Hat Universal Base Image container
+//
+// When cache is enabled, DNF cache is mounted from a cache volume shared by containers of the same image and platform, so that it is left out of the container.
+//
+// When an entitlement is given, Red Hat Enterprise Linux repositories are configured using mounted entitlement material, so that it is left out of the container.
 func (packages *RedhatPackages) Installed(
+	ctx context.Context,
 	// Container in which to install the packages
 	container *dagger.Container,
-) *dagger.Container {
-	return container.WithExec([]string{"sh", "-c", "dnf install --nodocs --setopt install_weak_deps=0 --assumeyes " + strings.Join(packages.Names, " ") + " && dnf clean all"})
+) (*dagger.Container, error) {
+	options := "--nodocs --setopt install_weak_deps=0 --assumeyes"
+	cleaning := " && dnf clean all"
+	mounts := []string{}
+
+	var unregister func(context.Context) error
+
+	if packages.Entitlement != nil {
+		var err error
+
+		container, mounts, unregister, err = packages.Entitlement.mounted(ctx, container, packages.Version)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if packages.Cache {
+		cache, err := packagesCache(ctx, container, "dnf", images[packages.Version].standard)
+
+		if err != nil {
+			return nil, err
+		}
+
+		container = container.
+			WithMountedCache(DnfCacheDir, cache, dagger.ContainerWithMountedCacheOpts{Sharing: dagger.CacheSharingModeLocked})
+
+		options += " --setopt keepcache=1"
+		cleaning = ""
+		mounts = append(mounts, DnfCacheDir)
+	}
+
+	container = container.
+		WithExec([]string{"sh", "-c", "dnf install " + options + " " + strings.Join(packages.Names, " ") + cleaning})
+
+	if unregister != nil {
+		// Packages are installed before unregistering the system, as its entitlement certificates are revoked along with it
+		_, err := container.Sync(ctx)
+
+		if unregisterErr := unregister(ctx); unregisterErr != nil {
+			return nil, unregisterErr
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to install packages: %w", err)
+		}
+	}
+
+	for _, mount := range mounts {
+		container = container.
+			WithoutMount(mount)
+	}
+
+	return container, nil
+}
+
+// Get the package manager cache volume of a container
+//
+// Cache volume is keyed by package manager, image and container platform as downloaded metadata and packages are specific to them.
+func packagesCache(
+	ctx context.Context,
+	container *dagger.Container,
+	packageManager string,
+	image image,
+) (*dagger.CacheVolume, error) {
+	platform, err := container.Platform(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container platform: %s", err)
+	}
+
+	key := strings.Join([]string{"redhat", packageManager, image.repository, image.tag, image.digest, strings.ReplaceAll(string(platform), "/", "-")}, "-")
+
+	return dag.CacheVolume(key), nil
 }
 
 // Remove packages in a Red Hat Universal Base Image container
@@ -94,65 +315,188 @@ func (packages *RedhatPackages) Removed(
 }
 
 // Install Red Hat Universal Base Image CA certificates in a container
+//
+// Additional CA certificates given to the constructor are trusted as well.
 func (redhat *Redhat) CaCertificates(
 	// Container in which to install the CA certificates
 	container *dagger.Container,
 ) *dagger.Container {
-	const installroot string = "/tmp/rootfs"
-	const caCertificatesPath string = "/etc/pki/ca-trust/extracted"
+	return container.WithDirectory(CaTrustExtractedDir, redhat.caTrust())
+}
+
+// Get a bundle of Red Hat Universal Base Image CA certificates in PEM format
+//
+// Additional CA certificates given to the constructor are included as well.
+func (redhat *Redhat) CaBundle() *dagger.File {
+	return redhat.caTrust().File("pem/tls-ca-bundle.pem")
+}
+
+// Trust additional CA certificates given to the constructor in a container
+func (redhat *Redhat) additionalCaCertificates(
+	container *dagger.Container,
+) *dagger.Container {
+	if len(redhat.AdditionalCaCertificates) == 0 {
+		return container
+	}
+
+	return container.WithDirectory(CaTrustExtractedDir, redhat.caTrust())
+}
+
+// Get a directory of extracted CA certificates trust, as found in `/etc/pki/ca-trust/extracted` directory
+func (redhat *Redhat) caTrust() *dagger.Directory {
+	// Container is not got from Container function, which trusts additional CA certificates with this directory
+	builder := dag.Container().
+		From(images[redhat.Version].standard.reference()).
+		WithWorkdir("/home")
+
+	// Additional CA certificates are trusted before upgrading CA certificates, as they may be needed to reach repositories (behind an intercepting proxy for instance)
+	for i, caCertificate := range redhat.AdditionalCaCertificates {
+		builder = builder.
+			WithFile(fmt.Sprintf("/etc/pki/ca-trust/source/anchors/additional-%d.pem", i), caCertificate)
+	}
 
-	caCertificates := redhat.Container("").
-		WithExec([]string{"sh", "-c", "mkdir " + installroot + " && dnf --installroot " + installroot + " install --nodocs --setopt install_weak_deps=0 --assumeyes ca-certificates && dnf --installroot " + installroot + " clean all"}).
-		Directory(installroot + "/" + caCertificatesPath)
+	builder = builder.
+		WithExec([]string{"update-ca-trust", "extract"}).
+		WithExec([]string{"sh", "-c", "dnf upgrade --nodocs --setopt install_weak_deps=0 --assumeyes ca-certificates && dnf clean all"}).
+		WithExec([]string{"update-ca-trust", "extract"})
 
-	return container.WithDirectory(caCertificatesPath, caCertificates)
+	return builder.Directory(CaTrustExtractedDir)
 }
 
 // Red Hat Minimal Universal Base Image
-type RedhatMinimal struct{}
+type RedhatMinimal struct {
+	// +private
+	Version string
+	// +private
+	AdditionalCaCertificates []*dagger.File
+}
 
 // Red Hat Minimal Universal Base Image constructor
-func (*Redhat) Minimal() *RedhatMinimal {
-	return &RedhatMinimal{}
+func (redhat *Redhat) Minimal() *RedhatMinimal {
+	minimal := &RedhatMinimal{
+		Version:                  redhat.Version,
+		AdditionalCaCertificates: redhat.AdditionalCaCertificates,
+	}
+
+	return minimal
 }
 
 // Get a Red Hat Minimal Universal Base Image container
-func (*RedhatMinimal) Container(
+//
+// Additional CA certificates given to the constructor are trusted in the container.
+func (minimal *RedhatMinimal) Container(
 	// Platform to get container for
 	// +optional
 	platform dagger.Platform,
 ) *dagger.Container {
 	container := dag.Container(dagger.ContainerOpts{Platform: platform}).
-		From(ImageRegistry + "/" + MinimalImageRepository + ":" + MinimalImageTag + "@" + MinimalImageDigest).
+		From(images[minimal.Version].minimal.reference()).
 		WithWorkdir("/home")
 
-	return container
+	redhat := &Redhat{
+		Version:                  minimal.Version,
+		AdditionalCaCertificates: minimal.AdditionalCaCertificates,
+	}
+
+	return redhat.additionalCaCertificates(container)
 }
 
 // Red Hat Minimal Universal Base Image packages
 type RedhatMinimalPackages struct {
+	// +private
+	Version string
 	// +private
 	Names []string
+	// +private
+	Cache bool
+	// +private
+	Entitlement *RedhatEntitlement
 }
 
 // Red Hat Minimal Universal Base Image packages constructor
-func (*RedhatMinimal) Packages(
+func (minimal *RedhatMinimal) Packages(
 	// Packages name
 	names []string,
+	// Reuse downloaded repository metadata and packages between installations
+	// +optional
+	cache bool,
+	// Red Hat subscription entitlement giving access to Red Hat Enterprise Linux repositories
+	// +optional
+	entitlement *RedhatEntitlement,
 ) *RedhatMinimalPackages {
 	packages := &RedhatMinimalPackages{
-		Names: names,
+		Version:     minimal.Version,
+		Names:       names,
+		Cache:       cache,
+		Entitlement: entitlement,
 	}
 
 	return packages
 }
 
 // Install packages in a Red Hat Minimal Universal Base Image container
+//
+// When cache is enabled, microdnf cache is mounted from a cache volume shared by containers of the same image and platform, so that it is left out of the container.
+//
+// When an entitlement is given, Red Hat Enterprise Linux repositories are configured using mounted entitlement material, so that it is left out of the container.
 func (packages *RedhatMinimalPackages) Installed(
+	ctx context.Context,
 	// Container in which to install the packages
 	container *dagger.Container,
-) *dagger.Container {
-	return container.WithExec([]string{"sh", "-c", "microdnf install --nodocs --setopt install_weak_deps=0 --assumeyes " + strings.Join(packages.Names, " ") + " && microdnf clean all"})
+) (*dagger.Container, error) {
+	options := "--nodocs --setopt install_weak_deps=0 --assumeyes"
+	cleaning := " && microdnf clean all"
+	mounts := []string{}
+
+	var unregister func(context.Context) error
+
+	if packages.Entitlement != nil {
+		var err error
+
+		container, mounts, unregister, err = packages.Entitlement.mounted(ctx, container, packages.Version)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if packages.Cache {
+		cache, err := packagesCache(ctx, container, "microdnf", images[packages.Version].minimal)
+
+		if err != nil {
+			return nil, err
+		}
+
+		container = container.
+			WithMountedCache(MicrodnfCacheDir, cache, dagger.ContainerWithMountedCacheOpts{Sharing: dagger.CacheSharingModeLocked})
+
+		options += " --setopt keepcache=1"
+		cleaning = ""
+		mounts = append(mounts, MicrodnfCacheDir)
+	}
+
+	container = container.
+		WithExec([]string{"sh", "-c", "microdnf install " + options + " " + strings.Join(packages.Names, " ") + cleaning})
+
+	if unregister != nil {
+		// Packages are installed before unregistering the system, as its entitlement certificates are revoked along with it
+		_, err := container.Sync(ctx)
+
+		if unregisterErr := unregister(ctx); unregisterErr != nil {
+			return nil, unregisterErr
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to install packages: %w", err)
+		}
+	}
+
+	for _, mount := range mounts {
+		container = container.
+			WithoutMount(mount)
+	}
+
+	return container, nil
 }
 
 // Remove packages in a Red Hat Minimal Universal Base Image container
@@ -164,22 +508,39 @@ func (packages *RedhatMinimalPackages) Removed(
 }
 
 // Red Hat Micro Universal Base Image
-type RedhatMicro struct{}
+type RedhatMicro struct {
+	// +private
+	Version string
+	// +private
+	AdditionalCaCertificates []*dagger.File
+}
 
 // Red Hat Micro Universal Base Image constructor
-func (*Redhat) Micro() *RedhatMicro {
-	return &RedhatMicro{}
+func (redhat *Redhat) Micro() *RedhatMicro {
+	micro := &RedhatMicro{
+		Version:                  redhat.Version,
+		AdditionalCaCertificates: redhat.AdditionalCaCertificates,
+	}
+
+	return micro
 }
 
 // Get a Red Hat Micro Universal Base Image container
-func (*RedhatMicro) Container(
+//
+// Additional CA certificates given to the constructor are trusted in the container.
+func (micro *RedhatMicro) Container(
 	// Platform to get container for
 	// +optional
 	platform dagger.Platform,
 ) *dagger.Container {
 	container := dag.Container(dagger.ContainerOpts{Platform: platform}).
-		From(ImageRegistry + "/" + MicroImageRepository + ":" + MicroImageTag + "@" + MicroImageDigest).
+		From(images[micro.Version].micro.reference()).
 		WithWorkdir("/home")
 
-	return container
+	redhat := &Redhat{
+		Version:                  micro.Version,
+		AdditionalCaCertificates: micro.AdditionalCaCertificates,
+	}
+
+	return redhat.additionalCaCertificates(container)
 }
@@ -0,0 +1,131 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/redhat/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// Red Hat Universal Base Image based container images publisher
+type RedhatPublisher struct {
+	// +private
+	Containers []*dagger.Container
+}
+
+// Red Hat Universal Base Image based container images publisher constructor
+//
+// Standard OCI labels and annotations are set on every container.
+func (redhat *Redhat) Publisher(
+	// Containers to publish, one per platform
+	containers []*dagger.Container,
+	// Red Hat Universal Base Image the containers are based on (standard, minimal or micro)
+	// +optional
+	// +default="standard"
+	base string,
+	// URL to get source code of the containers
+	// +optional
+	source string,
+	// Source code revision of the containers
+	// +optional
+	revision string,
+	// License of the containers software (as a SPDX license expression)
+	// +optional
+	licenses string,
+	// Additional OCI annotations to set on the containers (formatted as `name=value`)
+	// +optional
+	annotations []string,
+) (*RedhatPublisher, error) {
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("at least one container must be specified")
+	}
+
+	baseImage, ok := map[string]image{
+		"standard": images[redhat.Version].standard,
+		"minimal":  images[redhat.Version].minimal,
+		"micro":    images[redhat.Version].micro,
+	}[base]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown Red Hat Universal Base Image: %q", base)
+	}
+
+	labels := [][2]string{
+		{"org.opencontainers.image.base.name", ImageRegistry + "/" + baseImage.repository + ":" + baseImage.tag},
+		{"org.opencontainers.image.base.digest", baseImage.digest},
+		{"org.opencontainers.image.source", source},
+		{"org.opencontainers.image.revision", revision},
+		{"org.opencontainers.image.licenses", licenses},
+	}
+
+	additionalAnnotations := [][2]string{}
+
+	for _, annotation := range annotations {
+		name, value, found := strings.Cut(annotation, "=")
+
+		if !found {
+			return nil, fmt.Errorf("annotation is not formatted as name=value: %q", annotation)
+		}
+
+		additionalAnnotations = append(additionalAnnotations, [2]string{name, value})
+	}
+
+	publisher := &RedhatPublisher{}
+
+	for _, container := range containers {
+		for _, label := range labels {
+			if label[1] == "" {
+				continue
+			}
+
+			container = container.
+				WithLabel(label[0], label[1]).
+				WithAnnotation(label[0], label[1])
+		}
+
+		for _, annotation := range additionalAnnotations {
+			container = container.
+				WithAnnotation(annotation[0], annotation[1])
+		}
+
+		publisher.Containers = append(publisher.Containers, container)
+	}
+
+	return publisher, nil
+}
+
+// Publish the containers as a multi-platform container image
+//
+// Returns the fully qualified reference of the published container image.
+func (publisher *RedhatPublisher) Publish(
+	ctx context.Context,
+	// Address to publish the container image to (formatted as `registry/repository:tag`)
+	address string,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password
+	// +optional
+	password *dagger.Secret,
+) (string, error) {
+	container := dag.Container()
+
+	if password != nil {
+		container = container.
+			WithRegistryAuth(strings.Split(address, "/")[0], username, password)
+	}
+
+	return container.Publish(ctx, address, dagger.ContainerPublishOpts{
+		PlatformVariants: publisher.Containers,
+	})
+}
+
+// Get the containers as a multi-platform container image tarball in OCI layout
+func (publisher *RedhatPublisher) Tarball() *dagger.File {
+	return dag.Container().AsTarball(dagger.ContainerAsTarballOpts{
+		PlatformVariants: publisher.Containers,
+	})
+}
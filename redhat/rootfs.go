@@ -0,0 +1,76 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"dagger/redhat/internal/dagger"
+)
+
+// Script assembling under `$ROOTFS` the binaries given as arguments along with their dynamic libraries and runtime files
+const rootfsScript string = `
+set -eu
+
+mkdir -p "$ROOTFS/usr/bin" "$ROOTFS/usr/sbin" "$ROOTFS/usr/lib" "$ROOTFS/usr/lib64"
+
+# Keep top-level directories linked to /usr ones
+for directory in /bin /sbin /lib /lib64; do
+	if [ -L "$directory" ]; then
+		cp --archive "$directory" "$ROOTFS/"
+	fi
+done
+
+copy() {
+	if [ -e "$ROOTFS$1" ] || [ -L "$ROOTFS$1" ]; then
+		return
+	fi
+
+	cp --archive --parents "$1" "$ROOTFS"
+
+	if [ -L "$1" ]; then
+		copy "$(readlink --canonicalize "$1")"
+	fi
+}
+
+for binary in "$@"; do
+	copy "$binary"
+
+	for library in $(ldd "$binary" 2>/dev/null | grep --only-matching '/[^ ]*' || true); do
+		copy "$library"
+	done
+done
+
+for file in /etc/passwd /etc/group /etc/nsswitch.conf /etc/pki/ca-trust/extracted /etc/pki/tls/certs /etc/pki/tls/cert.pem /etc/ssl/certs /usr/share/zoneinfo; do
+	if [ -e "$file" ]; then
+		copy "$file"
+	fi
+done
+`
+
+// Get a distroless root filesystem containing only given binaries and what they need to run
+//
+// Binaries are copied from a builder container along with their dynamic libraries (as listed by `ldd`), users and groups, CA certificates and time zone data.
+//
+// Binaries needing extra files at runtime (for instance plugins or libraries loaded with `dlopen`) have to be completed with them.
+func (*Redhat) Rootfs(
+	// Container to copy the binaries and their dependencies from (for instance a Red Hat Universal Base Image container)
+	builder *dagger.Container,
+	// Paths of the binaries in the builder container
+	binaries []string,
+	// Root filesystem to add the files to (for instance the root filesystem of a Red Hat Micro Universal Base Image container), an empty one is used otherwise
+	// +optional
+	base *dagger.Directory,
+) *dagger.Directory {
+	const rootfs string = "/tmp/rootfs"
+
+	files := builder.
+		WithEnvVariable("ROOTFS", rootfs).
+		WithExec(append([]string{"sh", "-c", rootfsScript, "sh"}, binaries...)).
+		Directory(rootfs)
+
+	if base == nil {
+		return files
+	}
+
+	return base.WithDirectory("/", files)
+}
@@ -0,0 +1,116 @@
+// Red Hat module tests
+//
+// Check Red Hat module functions against local services.
+
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/tests/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// Container image of the local registry
+	RegistryImage string = "docker.io/library/registry:2.8.3"
+
+	// Hostname of the local registry
+	RegistryHost string = "registry:5000"
+)
+
+// Red Hat module tests
+type Tests struct{}
+
+// Check that pinned container images are updated to the latest tag pushed to a local registry
+// +check
+func (*Tests) ImageUpdates(
+	ctx context.Context,
+) error {
+	// Registry is started explicitly so that images pushed to it are kept until the updates are checked
+	registry, err := dag.Container().
+		From(RegistryImage).
+		WithExposedPort(5000).
+		AsService().
+		Start(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to start registry: %w", err)
+	}
+
+	defer registry.Stop(ctx)
+
+	skopeo := dag.Redhat().Container().
+		With(dag.Redhat().Packages([]string{"skopeo"}).Installed).
+		WithServiceBinding(strings.Split(RegistryHost, ":")[0], registry)
+
+	// Tags are pushed in an order different from the tags order, each tag with a different image
+	for _, tag := range []string{"1.2-100", "1.10-50", "1.10-200.1700000000", "1.9-300", "1.10-200"} {
+		skopeo = skopeo.
+			WithMountedFile("/tmp/"+tag+".tar", dag.Container().WithNewFile("/image", tag).AsTarball()).
+			WithExec([]string{"skopeo", "copy", "--dest-tls-verify=false", "oci-archive:/tmp/" + tag + ".tar", "docker://" + RegistryHost + "/test:" + tag})
+	}
+
+	digest, err := skopeo.
+		WithExec([]string{"skopeo", "inspect", "--tls-verify=false", "--format", "{{.Digest}}", "docker://" + RegistryHost + "/test:1.10-200.1700000000"}).
+		Stdout(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to get digest of pushed image: %w", err)
+	}
+
+	source := dag.Directory().
+		WithNewFile("main.go", `package main
+
+const (
+	ImageRegistry string = "`+RegistryHost+`"
+
+	TestImageRepository string = "test"
+	TestImageTag string = "1.2-100"
+	TestImageDigest string = ""
+
+	FloatingImageRepository string = "test"
+	FloatingImageTag string = "1.2"
+	FloatingImageDigest string = ""
+)
+`)
+
+	changes := dag.Redhat().ImageUpdates(source, dagger.RedhatImageUpdatesOpts{
+		Registry:        RegistryHost,
+		RegistryService: registry,
+		Insecure:        true,
+	})
+
+	modified, err := changes.ModifiedPaths(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to get modified paths: %w", err)
+	}
+
+	if !slices.Equal(modified, []string{"main.go"}) {
+		return fmt.Errorf("unexpected modified paths: %v", modified)
+	}
+
+	updated, err := changes.After().File("main.go").Contents(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to read updated file: %w", err)
+	}
+
+	for _, expected := range []string{
+		`TestImageTag string = "1.10-200.1700000000"`,
+		`TestImageDigest string = "` + strings.TrimSpace(digest) + `"`,
+		`FloatingImageTag string = "1.10-200.1700000000"`,
+		`FloatingImageDigest string = "` + strings.TrimSpace(digest) + `"`,
+	} {
+		if !strings.Contains(updated, expected) {
+			return fmt.Errorf("updated file does not contain %q:\n%s", expected, updated)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"dagger/redhat/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container image constants declaration pattern
+var imageConstantPattern = regexp.MustCompile(`(?m)^\s*(\w*)Image(Registry|Repository|Tag|Digest)\s+(?:string\s*)?=\s*"([^"]*)"`)
+
+// Container image pinned in a Go source file
+type pinnedImage struct {
+	// Prefix of the constants declaring the container image
+	prefix     string
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// Get a changeset updating the pinned Red Hat Universal Base Images of every major version to their latest tags
+// +cache="never"
+func (redhat *Redhat) Update(
+	ctx context.Context,
+	// Registry to query instead of the registry of the pinned images (can be used to query a mirror or a local registry)
+	// +optional
+	registry string,
+	// Service providing the registry to query
+	// +optional
+	registryService *dagger.Service,
+	// Query the registry without verifying TLS certificates or over plain HTTP
+	// +optional
+	insecure bool,
+) (*dagger.Changeset, error) {
+	return redhat.ImageUpdates(ctx, dag.CurrentModule().Source(), "main.go", registry, registryService, insecure)
+}
+
+// Get a changeset updating container images pinned in a Go source file to their latest tags
+//
+// A container image is pinned by `<prefix>ImageRepository`, `<prefix>ImageTag` and `<prefix>ImageDigest` constants, and is pulled from the registry given by `<prefix>ImageRegistry` constant, or `ImageRegistry` constant if the former is not declared.
+//
+// The latest tag of a container image is the greatest tag having the same format as the pinned tag, numbers being compared numerically. A floating tag (as in `9.6`) is replaced by the latest build-specific tag (as in `9.6-1754000177`) so that the image gets pinned.
+// +cache="never"
+func (redhat *Redhat) ImageUpdates(
+	ctx context.Context,
+	// Directory containing the Go source file
+	source *dagger.Directory,
+	// Path of the Go source file in the directory
+	// +optional
+	// +default="main.go"
+	path string,
+	// Registry to query instead of the registry of the pinned images (can be used to query a mirror or a local registry)
+	// +optional
+	registry string,
+	// Service providing the registry to query
+	// +optional
+	registryService *dagger.Service,
+	// Query the registry without verifying TLS certificates or over plain HTTP
+	// +optional
+	insecure bool,
+) (*dagger.Changeset, error) {
+	contents, err := source.File(path).Contents(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q file: %w", path, err)
+	}
+
+	pinned, err := pinnedImages(contents)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned images from %q file: %w", path, err)
+	}
+
+	container, err := redhat.Packages([]string{"skopeo"}, false, nil).Installed(ctx, redhat.Container(""))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to install skopeo: %w", err)
+	}
+
+	if registryService != nil {
+		if registry == "" {
+			return nil, fmt.Errorf("registry must be specified along with registry service")
+		}
+
+		container = container.
+			WithServiceBinding(strings.Split(registry, ":")[0], registryService)
+	}
+
+	container = container.
+		WithEnvVariable("CACHE_BUSTER", time.Now().String())
+
+	options := []string{}
+
+	if insecure {
+		options = append(options, "--tls-verify=false")
+	}
+
+	updated := contents
+
+	for _, image := range pinned {
+		imageRegistry := image.registry
+
+		if registry != "" {
+			imageRegistry = registry
+		}
+
+		reference := "docker://" + imageRegistry + "/" + image.repository
+
+		tagsJson, err := container.
+			WithExec(append([]string{"skopeo", "list-tags"}, append(options, reference)...)).
+			Stdout(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %q image: %w", image.repository, err)
+		}
+
+		var tags struct {
+			Tags []string
+		}
+
+		err = json.Unmarshal([]byte(tagsJson), &tags)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tags of %q image: %w", image.repository, err)
+		}
+
+		tag := latestTag(image.tag, tags.Tags)
+
+		digest, err := container.
+			WithExec(append([]string{"skopeo", "inspect", "--raw"}, append(options, reference+":"+tag)...), dagger.ContainerWithExecOpts{RedirectStdout: "/tmp/manifest.json"}).
+			WithExec([]string{"skopeo", "manifest-digest", "/tmp/manifest.json"}).
+			Stdout(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get digest of %q image %q tag: %w", image.repository, tag, err)
+		}
+
+		updated = withConstant(updated, image.prefix+"ImageTag", tag)
+		updated = withConstant(updated, image.prefix+"ImageDigest", strings.TrimSpace(digest))
+	}
+
+	changes := source.
+		WithNewFile(path, updated).
+		Changes(source)
+
+	return changes, nil
+}
+
+// Get container images pinned in a Go source file
+func pinnedImages(
+	contents string,
+) ([]*pinnedImage, error) {
+	constants := map[string]string{}
+	prefixes := []string{}
+
+	for _, match := range imageConstantPattern.FindAllStringSubmatch(contents, -1) {
+		constants[match[1]+"Image"+match[2]] = match[3]
+
+		if match[2] == "Repository" {
+			prefixes = append(prefixes, match[1])
+		}
+	}
+
+	pinned := []*pinnedImage{}
+
+	for _, prefix := range prefixes {
+		image := &pinnedImage{
+			prefix:     prefix,
+			repository: constants[prefix+"ImageRepository"],
+		}
+
+		var ok bool
+
+		if image.registry, ok = constants[prefix+"ImageRegistry"]; !ok {
+			if image.registry, ok = constants["ImageRegistry"]; !ok {
+				return nil, fmt.Errorf("no registry declared for %q image", image.repository)
+			}
+		}
+
+		if image.tag, ok = constants[prefix+"ImageTag"]; !ok {
+			return nil, fmt.Errorf("no tag declared for %q image", image.repository)
+		}
+
+		if image.digest, ok = constants[prefix+"ImageDigest"]; !ok {
+			return nil, fmt.Errorf("no digest declared for %q image", image.repository)
+		}
+
+		pinned = append(pinned, image)
+	}
+
+	return pinned, nil
+}
+
+// Build suffix of build-specific tags (as in `9.6-1754000177` or `8.10-1132.1733300785`)
+var buildSuffixPattern = regexp.MustCompile(`-\d+(?:\.\d+)?$`)
+
+// Get the latest tag having the same format as a pinned tag
+//
+// Build suffix of build-specific tags may have any format, build-specific tags are preferred to floating tags of the same version and only replaced by build-specific tags.
+func latestTag(
+	pinned string,
+	tags []string,
+) string {
+	numbers := regexp.MustCompile(`\d+`)
+
+	version := buildSuffixPattern.ReplaceAllString(pinned, "")
+
+	// Build-specific tags stay build-specific
+	buildSuffix := `(?:-(\d+)(?:\.(\d+))?)?`
+
+	if version != pinned {
+		buildSuffix = `-(\d+)(?:\.(\d+))?`
+	}
+
+	format := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(numbers.ReplaceAllString(version, "0")), "0", `(\d+)`) + buildSuffix + "$")
+
+	key := func(tag string) []int {
+		match := format.FindStringSubmatch(tag)
+
+		if match == nil {
+			return nil
+		}
+
+		key := []int{}
+
+		for _, number := range match[1:] {
+			// Missing build suffix numbers sort first
+			if number != "" {
+				value, _ := strconv.Atoi(number)
+				key = append(key, value)
+			}
+		}
+
+		return key
+	}
+
+	latest := pinned
+	latestKey := key(pinned)
+
+	for _, tag := range tags {
+		tagKey := key(tag)
+
+		if tagKey != nil && slices.Compare(tagKey, latestKey) > 0 {
+			latest = tag
+			latestKey = tagKey
+		}
+	}
+
+	return latest
+}
+
+// Set the value of a string constant in a Go source file
+func withConstant(
+	contents string,
+	name string,
+	value string,
+) string {
+	pattern := regexp.MustCompile(`(?m)^(\s*` + name + `\s+(?:string\s*)?=\s*)"[^"]*"`)
+
+	return pattern.ReplaceAllStringFunc(contents, func(declaration string) string {
+		return pattern.FindStringSubmatch(declaration)[1] + strconv.Quote(value)
+	})
+}
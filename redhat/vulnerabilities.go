@@ -0,0 +1,967 @@
+// Copyright Camptocamp SA
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/bzip2"
+	"context"
+	"dagger/redhat/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Vulnerability severities rank
+var severities = map[string]int{
+	"low":       1,
+	"moderate":  2,
+	"important": 3,
+	"critical":  4,
+}
+
+// Location of DNF modules configuration
+const dnfModulesDir string = "/etc/dnf/modules.d"
+
+// Vulnerability of a container package
+type RedhatVulnerability struct {
+	// CVE identifier
+	Cve string
+	// Severity (low, moderate, important or critical)
+	Severity string
+	// Red Hat security advisory fixing the vulnerability
+	Advisory string
+	// Name of the vulnerable package
+	Package string
+	// Installed version of the package
+	InstalledVersion string
+	// Version of the package fixing the vulnerability
+	FixedVersion string
+}
+
+// Vulnerabilities of container packages
+type RedhatVulnerabilities struct {
+	// Get vulnerabilities of container packages
+	Vulnerabilities []*RedhatVulnerability
+	// Get warnings about security data which could not be evaluated
+	Warnings []string
+}
+
+// Get vulnerabilities of the packages installed in a Red Hat Universal Base Image container
+//
+// Installed packages are matched against Red Hat security data in OVAL format (for instance `rhel-10.oval.xml.bz2` file, compressed or not, from https://security.access.redhat.com/data/oval/v2/), so that no external service is involved.
+//
+// RPM information, RPM file verification and text file content tests are evaluated, the latter against DNF modules configuration and files given by their exact path. Other tests are considered unsatisfied, with a warning in the result.
+func (redhat *Redhat) Vulnerabilities(
+	ctx context.Context,
+	// Container to scan
+	container *dagger.Container,
+	// Red Hat security data file in OVAL format
+	securityData *dagger.File,
+	// Fail if a vulnerability of this severity or higher is found (low, moderate, important or critical)
+	// +optional
+	failOn string,
+) (*RedhatVulnerabilities, error) {
+	if failOn != "" {
+		if _, ok := severities[strings.ToLower(failOn)]; !ok {
+			return nil, fmt.Errorf("unknown severity: %q", failOn)
+		}
+	}
+
+	// Security data file is exported to a file specific to this call, so that concurrent calls do not overwrite it
+	securityDataFile, err := os.CreateTemp("", "security-data-*.oval.xml")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create security data file: %w", err)
+	}
+
+	securityDataFile.Close()
+
+	defer os.Remove(securityDataFile.Name())
+
+	securityDataPath, err := securityData.Export(ctx, securityDataFile.Name())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to export security data file: %w", err)
+	}
+
+	definitions, err := readOvalDefinitions(securityDataPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read security data file: %w", err)
+	}
+
+	evaluator := newOvalEvaluator(definitions)
+
+	const rootfs string = "/tmp/rootfs"
+
+	inventory, err := redhat.Container("").
+		WithMountedDirectory(rootfs, container.Rootfs()).
+		WithExec([]string{"rpm", "--root", rootfs, "--query", "--all", "--queryformat", "%{NAME} %{EPOCHNUM}:%{VERSION}-%{RELEASE} %{ARCH} %|RSAHEADER?{%{RSAHEADER:pgpsig}}:{(none)}|\n"}).
+		Stdout(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installed packages: %w", err)
+	}
+
+	signatureKeyIdPattern := regexp.MustCompile(`Key ID ([0-9a-fA-F]+)`)
+
+	for _, line := range strings.Split(strings.TrimSpace(inventory), "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 4 {
+			continue
+		}
+
+		installed := installedPackage{
+			name: fields[0],
+			evr:  fields[1],
+			arch: fields[2],
+		}
+
+		if match := signatureKeyIdPattern.FindStringSubmatch(line); match != nil {
+			installed.signatureKeyId = strings.ToLower(match[1])
+		}
+
+		evaluator.packages[installed.name] = append(evaluator.packages[installed.name], installed)
+	}
+
+	// Files verified by tests are mapped to the packages owning them
+	if len(evaluator.verifiedFiles) > 0 {
+		owners, err := redhat.Container("").
+			WithMountedDirectory(rootfs, container.Rootfs()).
+			WithExec(append([]string{"sh", "-c", `for file; do rpm --root "$0" --query --file --queryformat "$file %{NAME}\n" "$file" 2> /dev/null || true; done`, rootfs}, evaluator.verifiedFiles...)).
+			Stdout(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get verified files owners: %w", err)
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(owners), "\n") {
+			if file, owner, found := strings.Cut(line, " "); found {
+				evaluator.owners[file] = append(evaluator.owners[file], owner)
+			}
+		}
+	}
+
+	// Text file content tests are evaluated against DNF modules configuration and files given by their exact path
+	textFiles, err := container.Rootfs().Glob(ctx, strings.TrimPrefix(dnfModulesDir, "/")+"/*")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNF modules configuration files: %w", err)
+	}
+
+	for i, file := range textFiles {
+		textFiles[i] = "/" + file
+	}
+
+	for _, file := range evaluator.textFiles {
+		exists, err := container.Rootfs().Exists(ctx, file)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %q file: %w", file, err)
+		}
+
+		if exists && !slices.Contains(textFiles, file) {
+			textFiles = append(textFiles, file)
+		}
+	}
+
+	for _, file := range textFiles {
+		contents, err := container.Rootfs().File(file).Contents(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q file: %w", file, err)
+		}
+
+		evaluator.files[file] = contents
+	}
+
+	result := &RedhatVulnerabilities{
+		Vulnerabilities: evaluator.vulnerabilities(definitions),
+		Warnings:        []string{},
+	}
+
+	for _, kind := range evaluator.unsupportedTests {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("OVAL %s tests are not supported and are considered unsatisfied", kind))
+	}
+
+	if failOn != "" {
+		failing := []string{}
+
+		for _, vulnerability := range result.Vulnerabilities {
+			if severities[vulnerability.Severity] >= severities[strings.ToLower(failOn)] {
+				failing = append(failing, fmt.Sprintf("%s (%s) in %s %s, fixed in %s", vulnerability.Cve, vulnerability.Severity, vulnerability.Package, vulnerability.InstalledVersion, vulnerability.FixedVersion))
+			}
+		}
+
+		if len(failing) > 0 {
+			return nil, fmt.Errorf("found %d vulnerabilities of %s severity or higher:\n%s", len(failing), strings.ToLower(failOn), strings.Join(failing, "\n"))
+		}
+	}
+
+	return result, nil
+}
+
+// Installed package
+type installedPackage struct {
+	name string
+	// Epoch, version and release
+	evr  string
+	arch string
+	// Key ID of the package signature, empty if not signed
+	signatureKeyId string
+}
+
+// OVAL definitions file
+type ovalDefinitions struct {
+	Definitions []ovalDefinition
+	Tests       []ovalTest
+	Objects     []ovalObject
+	States      []ovalState
+}
+
+// Read an OVAL definitions file, compressed with bzip2 or not
+func readOvalDefinitions(
+	name string,
+) (*ovalDefinitions, error) {
+	file, err := os.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+
+	var reader io.Reader = buffered
+
+	if magic, err := buffered.Peek(3); err == nil && bytes.Equal(magic, []byte("BZh")) {
+		reader = bzip2.NewReader(buffered)
+	}
+
+	decoder := xml.NewDecoder(reader)
+
+	definitions := &ovalDefinitions{}
+
+	// Section of the definitions file whose elements are decoded
+	section := ""
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch section {
+			case "definitions":
+				var definition ovalDefinition
+
+				if err := decoder.DecodeElement(&definition, &element); err != nil {
+					return nil, err
+				}
+
+				definitions.Definitions = append(definitions.Definitions, definition)
+			case "tests":
+				var test ovalTest
+
+				if err := decoder.DecodeElement(&test, &element); err != nil {
+					return nil, err
+				}
+
+				definitions.Tests = append(definitions.Tests, test)
+			case "objects":
+				var object ovalObject
+
+				if err := decoder.DecodeElement(&object, &element); err != nil {
+					return nil, err
+				}
+
+				definitions.Objects = append(definitions.Objects, object)
+			case "states":
+				var state ovalState
+
+				if err := decoder.DecodeElement(&state, &element); err != nil {
+					return nil, err
+				}
+
+				definitions.States = append(definitions.States, state)
+			default:
+				section = element.Name.Local
+			}
+		case xml.EndElement:
+			if element.Name.Local == section {
+				section = ""
+			}
+		}
+	}
+
+	return definitions, nil
+}
+
+// OVAL definition
+type ovalDefinition struct {
+	Metadata struct {
+		References []struct {
+			Id     string `xml:"ref_id,attr"`
+			Source string `xml:"source,attr"`
+		} `xml:"reference"`
+		Advisory struct {
+			Severity string `xml:"severity"`
+			Cves     []struct {
+				Id     string `xml:",chardata"`
+				Impact string `xml:"impact,attr"`
+			} `xml:"cve"`
+		} `xml:"advisory"`
+	} `xml:"metadata"`
+	Criteria ovalCriteria `xml:"criteria"`
+}
+
+// OVAL criteria
+type ovalCriteria struct {
+	Operator   string         `xml:"operator,attr"`
+	Negate     bool           `xml:"negate,attr"`
+	Criteria   []ovalCriteria `xml:"criteria"`
+	Criterions []struct {
+		TestRef string `xml:"test_ref,attr"`
+		Negate  bool   `xml:"negate,attr"`
+	} `xml:"criterion"`
+}
+
+// OVAL test
+type ovalTest struct {
+	XMLName        xml.Name
+	Id             string `xml:"id,attr"`
+	Check          string `xml:"check,attr"`
+	CheckExistence string `xml:"check_existence,attr"`
+	Object         struct {
+		Ref string `xml:"object_ref,attr"`
+	} `xml:"object"`
+	States []struct {
+		Ref string `xml:"state_ref,attr"`
+	} `xml:"state"`
+}
+
+// OVAL object
+type ovalObject struct {
+	Id string `xml:"id,attr"`
+	// Package name, for RPM information objects
+	Name string `xml:"name"`
+	// File path, for RPM file verification and text file content objects
+	Filepath *ovalValue `xml:"filepath"`
+	// Directory and file name, for text file content objects
+	Path     *ovalValue `xml:"path"`
+	Filename *ovalValue `xml:"filename"`
+	// Pattern and instance of the text to match, for text file content objects
+	Pattern  *ovalValue `xml:"pattern"`
+	Instance *ovalValue `xml:"instance"`
+}
+
+// OVAL state
+type ovalState struct {
+	Id             string     `xml:"id,attr"`
+	Name           *ovalValue `xml:"name"`
+	Arch           *ovalValue `xml:"arch"`
+	Evr            *ovalValue `xml:"evr"`
+	Version        *ovalValue `xml:"version"`
+	SignatureKeyId *ovalValue `xml:"signature_keyid"`
+	Text           *ovalValue `xml:"text"`
+	Subexpression  *ovalValue `xml:"subexpression"`
+}
+
+// OVAL state value
+type ovalValue struct {
+	Operation string `xml:"operation,attr"`
+	Value     string `xml:",chardata"`
+}
+
+// Item collected for an OVAL object
+type ovalItem struct {
+	// Installed package, for RPM tests
+	installed *installedPackage
+	// Matched text and subexpressions, for text file content tests
+	text           string
+	subexpressions []string
+}
+
+// Package matched by an OVAL test on its version
+type ovalMatch struct {
+	name         string
+	installedEvr string
+	fixedEvr     string
+}
+
+// OVAL definitions evaluator
+type ovalEvaluator struct {
+	tests   map[string]ovalTest
+	objects map[string]ovalObject
+	states  map[string]ovalState
+	// Installed packages by name
+	packages map[string][]installedPackage
+	// Files verified by RPM file verification objects, and names of the packages owning them
+	verifiedFiles []string
+	owners        map[string][]string
+	// Files read by text file content objects given by their exact path, and contents of the text files
+	textFiles []string
+	files     map[string]string
+	// Kinds of tests that cannot be evaluated
+	unsupportedTests []string
+}
+
+// OVAL definitions evaluator constructor
+func newOvalEvaluator(
+	definitions *ovalDefinitions,
+) *ovalEvaluator {
+	evaluator := &ovalEvaluator{
+		tests:    map[string]ovalTest{},
+		objects:  map[string]ovalObject{},
+		states:   map[string]ovalState{},
+		packages: map[string][]installedPackage{},
+		owners:   map[string][]string{},
+		files:    map[string]string{},
+	}
+
+	for _, test := range definitions.Tests {
+		evaluator.tests[test.Id] = test
+	}
+
+	for _, object := range definitions.Objects {
+		evaluator.objects[object.Id] = object
+	}
+
+	for _, state := range definitions.States {
+		evaluator.states[state.Id] = state
+	}
+
+	for _, test := range definitions.Tests {
+		object := evaluator.objects[test.Object.Ref]
+
+		switch test.XMLName.Local {
+		case "rpmverifyfile_test":
+			if object.Filepath != nil && !slices.Contains(evaluator.verifiedFiles, object.Filepath.Value) {
+				evaluator.verifiedFiles = append(evaluator.verifiedFiles, object.Filepath.Value)
+			}
+		case "textfilecontent54_test":
+			file := ""
+
+			if object.Filepath != nil && (object.Filepath.Operation == "" || object.Filepath.Operation == "equals") {
+				file = object.Filepath.Value
+			} else if object.Path != nil && object.Filename != nil && (object.Path.Operation == "" || object.Path.Operation == "equals") && (object.Filename.Operation == "" || object.Filename.Operation == "equals") {
+				file = path.Join(object.Path.Value, object.Filename.Value)
+			}
+
+			if file != "" && !slices.Contains(evaluator.textFiles, file) {
+				evaluator.textFiles = append(evaluator.textFiles, file)
+			}
+		}
+	}
+
+	return evaluator
+}
+
+// Get vulnerabilities of installed packages
+func (evaluator *ovalEvaluator) vulnerabilities(
+	definitions *ovalDefinitions,
+) []*RedhatVulnerability {
+	vulnerabilities := []*RedhatVulnerability{}
+
+	for _, definition := range definitions.Definitions {
+		vulnerable, matches := evaluator.criteria(definition.Criteria)
+
+		if !vulnerable {
+			continue
+		}
+
+		advisory := ""
+
+		for _, reference := range definition.Metadata.References {
+			if reference.Source != "CVE" {
+				advisory = reference.Id
+			}
+		}
+
+		for _, cve := range definition.Metadata.Advisory.Cves {
+			severity := strings.ToLower(cve.Impact)
+
+			if severity == "" {
+				severity = strings.ToLower(definition.Metadata.Advisory.Severity)
+			}
+
+			for _, match := range matches {
+				vulnerabilities = append(vulnerabilities, &RedhatVulnerability{
+					Cve:              strings.TrimSpace(cve.Id),
+					Severity:         severity,
+					Advisory:         advisory,
+					Package:          match.name,
+					InstalledVersion: match.installedEvr,
+					FixedVersion:     match.fixedEvr,
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(vulnerabilities, func(a, b *RedhatVulnerability) int {
+		return cmp.Or(
+			cmp.Compare(severities[b.Severity], severities[a.Severity]),
+			cmp.Compare(a.Cve, b.Cve),
+			cmp.Compare(a.Package, b.Package),
+		)
+	})
+
+	return vulnerabilities
+}
+
+// Evaluate OVAL criteria
+//
+// Packages matched by tests on their version are returned along with the result when criteria are true.
+func (evaluator *ovalEvaluator) criteria(
+	criteria ovalCriteria,
+) (bool, []ovalMatch) {
+	results := []bool{}
+	matches := []ovalMatch{}
+
+	for _, criterion := range criteria.Criterions {
+		result, match := evaluator.test(criterion.TestRef)
+
+		if criterion.Negate {
+			result = !result
+			match = nil
+		}
+
+		results = append(results, result)
+
+		if result && match != nil {
+			matches = append(matches, *match)
+		}
+	}
+
+	for _, subcriteria := range criteria.Criteria {
+		result, subcriteriaMatches := evaluator.criteria(subcriteria)
+
+		results = append(results, result)
+
+		if result {
+			matches = append(matches, subcriteriaMatches...)
+		}
+	}
+
+	var result bool
+
+	if strings.EqualFold(criteria.Operator, "OR") {
+		result = slices.Contains(results, true)
+	} else {
+		result = !slices.Contains(results, false)
+	}
+
+	if criteria.Negate {
+		return !result, nil
+	}
+
+	if !result {
+		return false, nil
+	}
+
+	return true, matches
+}
+
+// Get the items collected for the object of an OVAL test
+//
+// Returns false if the test cannot be evaluated.
+func (evaluator *ovalEvaluator) items(
+	test ovalTest,
+) ([]ovalItem, bool) {
+	object := evaluator.objects[test.Object.Ref]
+	items := []ovalItem{}
+
+	switch test.XMLName.Local {
+	case "rpminfo_test":
+		for _, installed := range evaluator.packages[object.Name] {
+			items = append(items, ovalItem{installed: &installed})
+		}
+	case "rpmverifyfile_test":
+		if object.Filepath == nil {
+			return nil, false
+		}
+
+		for _, owner := range evaluator.owners[object.Filepath.Value] {
+			for _, installed := range evaluator.packages[owner] {
+				items = append(items, ovalItem{installed: &installed})
+			}
+		}
+	case "textfilecontent54_test":
+		if object.Pattern == nil || object.Pattern.Operation != "pattern match" {
+			return nil, false
+		}
+
+		// Text is matched line by line unless the pattern says otherwise, as with OVAL default behaviors
+		pattern, err := regexp.Compile("(?m)" + object.Pattern.Value)
+
+		if err != nil {
+			// OVAL patterns are Perl regular expressions, some of them are not supported by Go
+			return nil, false
+		}
+
+		for file, contents := range evaluator.files {
+			if object.Filepath != nil {
+				if !object.Filepath.matches(file, nil) {
+					continue
+				}
+			} else if object.Path == nil || object.Filename == nil || !object.Path.matches(path.Dir(file), nil) || !object.Filename.matches(path.Base(file), nil) {
+				continue
+			}
+
+			for instance, match := range pattern.FindAllStringSubmatch(contents, -1) {
+				if object.Instance != nil && !object.Instance.matches(strconv.Itoa(instance+1), compareIntegers) {
+					continue
+				}
+
+				items = append(items, ovalItem{
+					text:           match[0],
+					subexpressions: match[1:],
+				})
+			}
+		}
+	default:
+		return nil, false
+	}
+
+	return items, true
+}
+
+// Check whether an item satisfies an OVAL state
+func (state *ovalState) satisfied(
+	item ovalItem,
+) bool {
+	if installed := item.installed; installed != nil {
+		version := strings.SplitN(strings.SplitN(installed.evr, ":", 2)[1], "-", 2)[0]
+
+		return (state.Name == nil || state.Name.matches(installed.name, nil)) &&
+			(state.Arch == nil || state.Arch.matches(installed.arch, nil)) &&
+			(state.Version == nil || state.Version.matches(version, nil)) &&
+			(state.Evr == nil || state.Evr.matches(installed.evr, compareEvr)) &&
+			(state.SignatureKeyId == nil || state.SignatureKeyId.matches(installed.signatureKeyId, nil))
+	}
+
+	if state.Text != nil && !state.Text.matches(item.text, nil) {
+		return false
+	}
+
+	if state.Subexpression != nil {
+		for _, subexpression := range item.subexpressions {
+			if !state.Subexpression.matches(subexpression, nil) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Evaluate an OVAL test
+//
+// Tests that cannot be evaluated are considered false.
+func (evaluator *ovalEvaluator) test(
+	id string,
+) (bool, *ovalMatch) {
+	test, ok := evaluator.tests[id]
+
+	if !ok {
+		return false, nil
+	}
+
+	items, ok := evaluator.items(test)
+
+	if !ok {
+		if !slices.Contains(evaluator.unsupportedTests, test.XMLName.Local) {
+			evaluator.unsupportedTests = append(evaluator.unsupportedTests, test.XMLName.Local)
+		}
+
+		return false, nil
+	}
+
+	switch test.CheckExistence {
+	case "none_exist":
+		if len(items) > 0 {
+			return false, nil
+		}
+	case "only_one_exists":
+		if len(items) != 1 {
+			return false, nil
+		}
+	case "any_exist":
+	default:
+		if len(items) == 0 {
+			return false, nil
+		}
+	}
+
+	if len(items) == 0 || len(test.States) == 0 {
+		return true, nil
+	}
+
+	satisfying := 0
+
+	var match *ovalMatch
+
+	for _, item := range items {
+		satisfied := true
+
+		var itemMatch *ovalMatch
+
+		for _, stateRef := range test.States {
+			state := evaluator.states[stateRef.Ref]
+
+			if !state.satisfied(item) {
+				satisfied = false
+
+				break
+			}
+
+			// Packages whose version is less than the fixed version are vulnerable
+			if state.Evr != nil && strings.HasPrefix(state.Evr.Operation, "less than") {
+				itemMatch = &ovalMatch{
+					name:         item.installed.name,
+					installedEvr: item.installed.evr,
+					fixedEvr:     state.Evr.Value,
+				}
+			}
+		}
+
+		if satisfied {
+			satisfying++
+
+			if match == nil {
+				match = itemMatch
+			}
+		}
+	}
+
+	var result bool
+
+	switch test.Check {
+	case "at least one":
+		result = satisfying > 0
+	case "none satisfy", "none exist":
+		result = satisfying == 0
+		match = nil
+	case "only one":
+		result = satisfying == 1
+	default:
+		result = satisfying == len(items)
+	}
+
+	if !result {
+		return false, nil
+	}
+
+	return true, match
+}
+
+// Compare integers formatted as strings
+func compareIntegers(
+	a string,
+	b string,
+) int {
+	aInteger, _ := strconv.Atoi(a)
+	bInteger, _ := strconv.Atoi(b)
+
+	return cmp.Compare(aInteger, bInteger)
+}
+
+// Check whether an installed package value matches an OVAL state value
+func (value *ovalValue) matches(
+	installed string,
+	compare func(a, b string) int,
+) bool {
+	switch value.Operation {
+	case "pattern match":
+		pattern, err := regexp.Compile(value.Value)
+
+		return err == nil && pattern.MatchString(installed)
+	case "", "equals":
+		if compare != nil {
+			return compare(installed, value.Value) == 0
+		}
+
+		return installed == value.Value
+	case "not equal":
+		if compare != nil {
+			return compare(installed, value.Value) != 0
+		}
+
+		return installed != value.Value
+	}
+
+	if compare == nil {
+		return false
+	}
+
+	result := compare(installed, value.Value)
+
+	switch value.Operation {
+	case "less than":
+		return result < 0
+	case "less than or equal":
+		return result <= 0
+	case "greater than":
+		return result > 0
+	case "greater than or equal":
+		return result >= 0
+	}
+
+	return false
+}
+
+// Compare RPM epoch, version and release strings (formatted as `[epoch:]version-release`)
+func compareEvr(
+	a string,
+	b string,
+) int {
+	parse := func(evr string) (int, string, string) {
+		epoch := 0
+
+		if before, after, found := strings.Cut(evr, ":"); found {
+			epoch, _ = strconv.Atoi(before)
+			evr = after
+		}
+
+		version, release, _ := strings.Cut(evr, "-")
+
+		return epoch, version, release
+	}
+
+	aEpoch, aVersion, aRelease := parse(a)
+	bEpoch, bVersion, bRelease := parse(b)
+
+	return cmp.Or(
+		cmp.Compare(aEpoch, bEpoch),
+		compareRpmVersions(aVersion, bVersion),
+		compareRpmVersions(aRelease, bRelease),
+	)
+}
+
+// Compare RPM version or release strings as rpmvercmp does
+func compareRpmVersions(
+	a string,
+	b string,
+) int {
+	isSeparator := func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '~' || r == '^')
+	}
+
+	for a != "" || b != "" {
+		a = strings.TrimLeftFunc(a, isSeparator)
+		b = strings.TrimLeftFunc(b, isSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+
+			a, b = a[1:], b[1:]
+
+			continue
+		}
+
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+
+			if b == "" {
+				return 1
+			}
+
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+
+			a, b = a[1:], b[1:]
+
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := unicode.IsDigit(rune(a[0]))
+
+		segment := func(s string) (string, string) {
+			end := strings.IndexFunc(s, func(r rune) bool {
+				if numeric {
+					return !unicode.IsDigit(r)
+				}
+
+				return !unicode.IsLetter(r)
+			})
+
+			if end < 0 {
+				end = len(s)
+			}
+
+			return s[:end], s[end:]
+		}
+
+		var aSegment, bSegment string
+
+		aSegment, a = segment(a)
+		bSegment, b = segment(b)
+
+		if bSegment == "" {
+			if numeric {
+				return 1
+			}
+
+			return -1
+		}
+
+		if numeric {
+			aSegment = strings.TrimLeft(aSegment, "0")
+			bSegment = strings.TrimLeft(bSegment, "0")
+
+			if result := cmp.Compare(len(aSegment), len(bSegment)); result != 0 {
+				return result
+			}
+		}
+
+		if result := strings.Compare(aSegment, bSegment); result != 0 {
+			return result
+		}
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
@@ -23,15 +23,21 @@ const (
 type Sass struct {
 	// +private
 	Version string
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // Sass constructor
 func New(
 	// Sass version to get
 	version string,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with Sass
+	// +optional
+	caCertificates []*dagger.File,
 ) *Sass {
 	sass := &Sass{
-		Version: version,
+		Version:        version,
+		CaCertificates: caCertificates,
 	}
 
 	return sass
@@ -169,7 +175,9 @@ func (sass *Sass) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: sass.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform})
 
 	return sass.Container(ctx, container)
 }
@@ -181,7 +189,9 @@ func (sass *Sass) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: sass.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform})
 
 	return sass.Container(ctx, container)
 }
@@ -193,7 +203,9 @@ func (sass *Sass) RedhatMicroContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: sass.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform})
 
 	return sass.Container(ctx, container)
 }
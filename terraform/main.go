@@ -32,6 +32,8 @@ const (
 type Terraform struct {
 	// +private
 	Version string
+	// +private
+	CaCertificates []*dagger.File
 }
 
 // Terraform constructor
@@ -39,9 +41,13 @@ func New(
 	// Terraform version to get
 	// +optional
 	version string,
+	// Additional CA certificates in PEM format to trust in Red Hat containers with Terraform
+	// +optional
+	caCertificates []*dagger.File,
 ) *Terraform {
 	terraform := &Terraform{
-		Version: version,
+		Version:        version,
+		CaCertificates: caCertificates,
 	}
 
 	return terraform
@@ -197,8 +203,10 @@ func (terraform *Terraform) RedhatContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Container(dagger.RedhatContainerOpts{Platform: platform}).
-		With(dag.Redhat().Packages([]string{
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: terraform.CaCertificates})
+
+	container := redhat.Container(dagger.RedhatContainerOpts{Platform: platform}).
+		With(redhat.Packages([]string{
 			"git",
 			"diffutils",
 		}).Installed)
@@ -213,8 +221,10 @@ func (terraform *Terraform) RedhatMinimalContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
-		With(dag.Redhat().Minimal().Packages([]string{
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: terraform.CaCertificates})
+
+	container := redhat.Minimal().Container(dagger.RedhatMinimalContainerOpts{Platform: platform}).
+		With(redhat.Minimal().Packages([]string{
 			"git",
 			"diffutils",
 		}).Installed)
@@ -231,8 +241,10 @@ func (terraform *Terraform) RedhatMicroContainer(
 	// +optional
 	platform dagger.Platform,
 ) (*dagger.Container, error) {
-	container := dag.Redhat().Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform}).
-		With(dag.Redhat().CaCertificates)
+	redhat := dag.Redhat(dagger.RedhatOpts{CaCertificates: terraform.CaCertificates})
+
+	container := redhat.Micro().Container(dagger.RedhatMicroContainerOpts{Platform: platform}).
+		With(redhat.CaCertificates)
 
 	return terraform.Container(ctx, container, "")
 }